@@ -0,0 +1,650 @@
+package checkpoint
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/pkg/errors"
+
+	"github.com/dhellmann/gh-review-stats/logging"
+	"github.com/dhellmann/gh-review-stats/util"
+)
+
+// DefaultInterval is how often a checkpoint is saved while pull
+// requests are being processed
+const DefaultInterval = 30 * time.Second
+
+// FormatVersion is the version of the checkpoint format written by
+// this package
+const FormatVersion int = 2
+
+// Checkpoint saves the progress of a long run through the pull
+// requests of an organization, so it can be resumed after it is
+// interrupted. The file is a journal of gzip compressed JSON lines,
+// starting with a header. Each save appends the pull requests
+// processed and the pages listed since the one before, so the cost
+// of saving does not grow with the size of the run.
+type Checkpoint struct {
+	// Path is the file the checkpoint is saved in
+	Path string
+
+	// Interval is how often the checkpoint is saved, after a page
+	// of pull requests is finished
+	Interval time.Duration
+
+	// Log records when the checkpoint is saved
+	Log *logging.Logger
+
+	header    header
+	processed map[util.PRKey]*record
+	active    map[util.PRKey]*record
+	pending   map[util.PRKey]*github.PullRequest
+	pages     map[string]string
+
+	// unsaved holds the entries to append on the next save, and
+	// rewrite is true when the whole file has to be written instead
+	unsaved  []entry
+	rewrite  bool
+	lastSave time.Time
+	mu       sync.Mutex
+
+	// saving serializes the writes to the file
+	saving sync.Mutex
+}
+
+// header is the first entry of a checkpoint file
+type header struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Org       string    `json:"org"`
+	Repos     []string  `json:"repos"`
+
+	// Since is the earliest update date of the closed pull requests
+	// included, or zero if all of them were included.
+	Since time.Time `json:"since"`
+}
+
+// entry is one line of a checkpoint file. Only one of the fields is
+// set. Later entries for the same pull request or page replace the
+// earlier ones.
+type entry struct {
+	Header    *header             `json:"header,omitempty"`
+	Page      *page               `json:"page,omitempty"`
+	Pending   *github.PullRequest `json:"pending,omitempty"`
+	Processed *record             `json:"processed,omitempty"`
+}
+
+// page is the position reached by a listing of pull requests
+type page struct {
+	Key      string `json:"key"`
+	Position string `json:"position"`
+}
+
+// record holds a processed pull request and the details the
+// callback asked for. The details that were not asked for are nil,
+// so they can be fetched if a later run needs them.
+type record struct {
+	Pull          *github.PullRequest          `json:"pull"`
+	IssueComments []*github.IssueComment       `json:"issue_comments"`
+	PRComments    []*github.PullRequestComment `json:"pr_comments"`
+	Reviews       []*github.PullRequestReview  `json:"reviews"`
+	Commits       []*github.RepositoryCommit   `json:"commits"`
+	Timeline      []*github.Timeline           `json:"timeline"`
+	Merged        *bool                        `json:"merged"`
+
+	// changed is true when details were added since the record was
+	// last saved
+	changed bool
+}
+
+// New creates an empty checkpoint for the repositories
+func New(path, org string, repos []string, since time.Time) *Checkpoint {
+	c := newCheckpoint(path, header{
+		Version:   FormatVersion,
+		CreatedAt: time.Now().UTC(),
+		Org:       org,
+		Repos:     repos,
+		Since:     since,
+	})
+	c.rewrite = true
+	return c
+}
+
+func newCheckpoint(path string, h header) *Checkpoint {
+	return &Checkpoint{
+		Path:      path,
+		Interval:  DefaultInterval,
+		header:    h,
+		processed: map[util.PRKey]*record{},
+		active:    map[util.PRKey]*record{},
+		pending:   map[util.PRKey]*github.PullRequest{},
+		pages:     map[string]string{},
+		lastSave:  time.Now(),
+	}
+}
+
+// Load reads a checkpoint saved by an earlier run. The entries
+// after a damaged part at the end of the file, left by an
+// interruption while saving, are dropped and the file is written
+// again in full on the next save.
+func Load(path string) (*Checkpoint, error) {
+	f, err := os.Open(path) // #nosec G304
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("could not load checkpoint %s", path))
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("could not load checkpoint %s", path))
+	}
+	defer zr.Close()
+	decoder := json.NewDecoder(zr)
+
+	first := entry{}
+	if err := decoder.Decode(&first); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("could not load checkpoint %s", path))
+	}
+	if first.Header == nil || first.Header.Version != FormatVersion {
+		return nil, fmt.Errorf("the checkpoint %s was written by another version, run again without --resume", path)
+	}
+
+	c := newCheckpoint(path, *first.Header)
+	for {
+		e := entry{}
+		err := decoder.Decode(&e)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			c.rewrite = true
+			break
+		}
+		switch {
+		case e.Page != nil:
+			c.pages[e.Page.Key] = e.Page.Position
+		case e.Pending != nil:
+			c.pending[util.KeyFor(e.Pending)] = e.Pending
+		case e.Processed != nil:
+			key := util.KeyFor(e.Processed.Pull)
+			c.processed[key] = e.Processed
+			delete(c.pending, key)
+		}
+	}
+	return c, nil
+}
+
+// Org returns the organization the checkpoint is for
+func (c *Checkpoint) Org() string {
+	return c.header.Org
+}
+
+// Repos returns the repositories the checkpoint is for
+func (c *Checkpoint) Repos() []string {
+	return c.header.Repos
+}
+
+// Since returns the earliest update date of the closed pull
+// requests being processed
+func (c *Checkpoint) Since() time.Time {
+	return c.header.Since
+}
+
+// Count returns the number of pull requests processed so far
+func (c *Checkpoint) Count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.processed)
+}
+
+// Save appends the progress made since the last save to the
+// checkpoint file. The first save of a new checkpoint writes the
+// whole file, replacing it in one step so an interruption while
+// saving does not lose the previous checkpoint.
+func (c *Checkpoint) Save() error {
+	c.saving.Lock()
+	defer c.saving.Unlock()
+
+	c.mu.Lock()
+	rewrite := c.rewrite
+	entries := c.unsaved
+	if rewrite {
+		entries = c.entries()
+	}
+	c.unsaved = nil
+	c.rewrite = false
+	count := len(c.processed)
+	c.mu.Unlock()
+
+	var err error
+	if rewrite {
+		err = c.replace(entries)
+	} else if len(entries) > 0 {
+		err = c.appendEntries(entries)
+	}
+	if err != nil {
+		// Keep the entries for the next attempt.
+		c.mu.Lock()
+		c.rewrite = c.rewrite || rewrite
+		if !rewrite {
+			c.unsaved = append(entries, c.unsaved...)
+		}
+		c.mu.Unlock()
+		return errors.Wrap(err, fmt.Sprintf("could not save checkpoint %s", c.Path))
+	}
+
+	c.mu.Lock()
+	c.lastSave = time.Now()
+	c.mu.Unlock()
+	c.Log.Debug("saved checkpoint", "path", c.Path, "pull_requests", count,
+		"entries", len(entries))
+	return nil
+}
+
+// entries returns all of the progress saved in the checkpoint, to
+// write the whole file. It must be called with mu held.
+func (c *Checkpoint) entries() []entry {
+	h := c.header
+	entries := []entry{{Header: &h}}
+
+	keys := []string{}
+	for key := range c.pages {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		entries = append(entries, entry{Page: &page{Key: key, Position: c.pages[key]}})
+	}
+
+	pending := []*github.PullRequest{}
+	for _, pr := range c.pending {
+		pending = append(pending, pr)
+	}
+	sortPullRequests(pending)
+	for _, pr := range pending {
+		entries = append(entries, entry{Pending: pr})
+	}
+
+	processed := []*record{}
+	for _, r := range c.processed {
+		saved := *r
+		r.changed = false
+		processed = append(processed, &saved)
+	}
+	sort.Slice(processed, func(i, j int) bool {
+		return lessKey(util.KeyFor(processed[i].Pull), util.KeyFor(processed[j].Pull))
+	})
+	for _, r := range processed {
+		entries = append(entries, entry{Processed: r})
+	}
+	return entries
+}
+
+// replace writes the entries to a new file in place of the old one
+func (c *Checkpoint) replace(entries []entry) error {
+	tmp := c.Path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := writeEntries(f, entries); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.Path)
+}
+
+// appendEntries adds the entries to the end of the file
+func (c *Checkpoint) appendEntries(entries []entry) error {
+	f, err := os.OpenFile(c.Path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := writeEntries(f, entries); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeEntries writes the entries as one gzip stream. The streams
+// written by each save are read back as one.
+func writeEntries(w io.Writer, entries []entry) error {
+	buffered := bufio.NewWriter(w)
+	zw := gzip.NewWriter(buffered)
+	encoder := json.NewEncoder(zw)
+	for i := range entries {
+		if err := encoder.Encode(&entries[i]); err != nil {
+			return errors.Wrap(err, "could not encode checkpoint")
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// Remove deletes the checkpoint file, once it is no longer needed
+func (c *Checkpoint) Remove() error {
+	if err := os.Remove(c.Path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, fmt.Sprintf("could not remove checkpoint %s", c.Path))
+	}
+	return nil
+}
+
+func lessKey(a, b util.PRKey) bool {
+	if a.Repo != b.Repo {
+		return a.Repo < b.Repo
+	}
+	return a.Number > b.Number
+}
+
+func sortPullRequests(prs []*github.PullRequest) {
+	sort.Slice(prs, func(i, j int) bool {
+		return lessKey(util.KeyFor(prs[i]), util.KeyFor(prs[j]))
+	})
+}
+
+// saveIfDue saves the checkpoint if it has not been saved for
+// Interval
+func (c *Checkpoint) saveIfDue() {
+	c.mu.Lock()
+	due := time.Since(c.lastSave) >= c.Interval
+	c.mu.Unlock()
+	if !due {
+		return
+	}
+	if err := c.Save(); err != nil {
+		c.Log.Warn("could not save checkpoint", "err", err)
+	}
+}
+
+// Source returns a PullRequestSource that processes the pull
+// requests saved in the checkpoint first, then the ones listed by
+// the query, skipping the ones processed before. The details the
+// callback asks for are recorded in the checkpoint once it has
+// finished with the pull request, and served from there when it is
+// processed again after resuming.
+func (c *Checkpoint) Source(query *util.PullRequestQuery) util.PullRequestSource {
+	return &source{checkpoint: c, query: query}
+}
+
+type source struct {
+	checkpoint *Checkpoint
+	query      *util.PullRequestQuery
+}
+
+func (s *source) IteratePullRequests(ctx context.Context, callback util.PRCallback) error {
+	c := s.checkpoint
+
+	c.mu.Lock()
+	saved := []*github.PullRequest{}
+	for _, r := range c.processed {
+		saved = append(saved, r.Pull)
+	}
+	pending := []*github.PullRequest{}
+	for _, pr := range c.pending {
+		pending = append(pending, pr)
+	}
+	resume := map[string]string{}
+	for key, position := range c.pages {
+		resume[key] = position
+	}
+	c.mu.Unlock()
+	sortPullRequests(saved)
+	sortPullRequests(pending)
+
+	// The saved pull requests count as processed, since the
+	// listings they came from are expected in full.
+	for _, pr := range saved {
+		if err := ctx.Err(); err != nil {
+			return nil
+		}
+		if err := s.run(ctx, pr, callback); err != nil && errors.Cause(err) != util.ErrLeftOut {
+			return err
+		}
+		s.query.Progress.Done()
+	}
+
+	process := func(ctx context.Context, pr *github.PullRequest) error {
+		key := util.KeyFor(pr)
+		c.mu.Lock()
+		_, done := c.processed[key]
+		if _, listed := c.pending[key]; !done && !listed {
+			c.pending[key] = pr
+			c.unsaved = append(c.unsaved, entry{Pending: pr})
+		}
+		c.mu.Unlock()
+		if done {
+			return nil
+		}
+		return s.run(ctx, pr, callback)
+	}
+
+	for _, pr := range pending {
+		if err := ctx.Err(); err != nil {
+			return nil
+		}
+		if err := process(ctx, pr); err != nil && errors.Cause(err) != util.ErrLeftOut {
+			return err
+		}
+	}
+
+	s.query.Resume = resume
+	s.query.OnPage = func(key, position string) {
+		c.mu.Lock()
+		c.pages[key] = position
+		c.unsaved = append(c.unsaved, entry{Page: &page{Key: key, Position: position}})
+		c.mu.Unlock()
+		c.saveIfDue()
+	}
+	return s.query.IteratePullRequests(ctx, process)
+}
+
+// run passes the pull request to the callback, recording the
+// details it asks for. The pull request is marked as processed when
+// the callback succeeds or leaves it out of the results, and stays
+// pending when the callback fails or is interrupted.
+func (s *source) run(ctx context.Context, pr *github.PullRequest, callback util.PRCallback) error {
+	c := s.checkpoint
+	key := util.KeyFor(pr)
+
+	c.mu.Lock()
+	r, done := c.processed[key]
+	if !done {
+		r = &record{Pull: pr}
+	}
+	c.active[key] = r
+	c.mu.Unlock()
+
+	err := callback(ctx, pr)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.active, key)
+	if ctx.Err() != nil {
+		// The callback was interrupted, possibly after being given
+		// partial details and without an error, so the pull request
+		// is not marked as processed.
+		return err
+	}
+	if err != nil && errors.Cause(err) != util.ErrLeftOut {
+		return err
+	}
+	if !done || r.changed {
+		c.processed[key] = r
+		delete(c.pending, key)
+		saved := *r
+		r.changed = false
+		c.unsaved = append(c.unsaved, entry{Processed: &saved})
+	}
+	return err
+}
+
+// recall serves a detail of a pull request the callback is
+// processing from its record. When the record does not hold the
+// detail yet, fetch reads it from the query and keep adds it to the
+// record. The details of the other pull requests, and the ones read
+// after the context is cancelled, which may be incomplete, are not
+// recorded.
+func (s *source) recall(ctx context.Context, pr *github.PullRequest, recorded func(r *record) bool, fetch func() error, keep func(r *record)) error {
+	c := s.checkpoint
+	c.mu.Lock()
+	r := c.active[util.KeyFor(pr)]
+	found := r != nil && recorded(r)
+	c.mu.Unlock()
+	if found {
+		return nil
+	}
+
+	if err := fetch(); err != nil {
+		return err
+	}
+	if r != nil && ctx.Err() == nil {
+		c.mu.Lock()
+		keep(r)
+		r.changed = true
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+func (s *source) Repositories() []string {
+	return s.query.Repositories()
+}
+
+func (s *source) GetPullRequest(ctx context.Context, repo string, number int) (*github.PullRequest, error) {
+	return s.query.GetPullRequest(ctx, repo, number)
+}
+
+func (s *source) GetIssueComments(ctx context.Context, pr *github.PullRequest) ([]*github.IssueComment, error) {
+	var comments []*github.IssueComment
+	err := s.recall(ctx, pr,
+		func(r *record) bool {
+			comments = r.IssueComments
+			return comments != nil
+		},
+		func() (err error) {
+			comments, err = s.query.GetIssueComments(ctx, pr)
+			return err
+		},
+		func(r *record) {
+			if comments == nil {
+				comments = []*github.IssueComment{}
+			}
+			r.IssueComments = comments
+		})
+	return comments, err
+}
+
+func (s *source) GetPRComments(ctx context.Context, pr *github.PullRequest) ([]*github.PullRequestComment, error) {
+	var comments []*github.PullRequestComment
+	err := s.recall(ctx, pr,
+		func(r *record) bool {
+			comments = r.PRComments
+			return comments != nil
+		},
+		func() (err error) {
+			comments, err = s.query.GetPRComments(ctx, pr)
+			return err
+		},
+		func(r *record) {
+			if comments == nil {
+				comments = []*github.PullRequestComment{}
+			}
+			r.PRComments = comments
+		})
+	return comments, err
+}
+
+func (s *source) GetReviews(ctx context.Context, pr *github.PullRequest) ([]*github.PullRequestReview, error) {
+	var reviews []*github.PullRequestReview
+	err := s.recall(ctx, pr,
+		func(r *record) bool {
+			reviews = r.Reviews
+			return reviews != nil
+		},
+		func() (err error) {
+			reviews, err = s.query.GetReviews(ctx, pr)
+			return err
+		},
+		func(r *record) {
+			if reviews == nil {
+				reviews = []*github.PullRequestReview{}
+			}
+			r.Reviews = reviews
+		})
+	return reviews, err
+}
+
+func (s *source) GetCommits(ctx context.Context, pr *github.PullRequest) ([]*github.RepositoryCommit, error) {
+	var commits []*github.RepositoryCommit
+	err := s.recall(ctx, pr,
+		func(r *record) bool {
+			commits = r.Commits
+			return commits != nil
+		},
+		func() (err error) {
+			commits, err = s.query.GetCommits(ctx, pr)
+			return err
+		},
+		func(r *record) {
+			if commits == nil {
+				commits = []*github.RepositoryCommit{}
+			}
+			r.Commits = commits
+		})
+	return commits, err
+}
+
+func (s *source) GetTimeline(ctx context.Context, pr *github.PullRequest) ([]*github.Timeline, error) {
+	var timeline []*github.Timeline
+	err := s.recall(ctx, pr,
+		func(r *record) bool {
+			timeline = r.Timeline
+			return timeline != nil
+		},
+		func() (err error) {
+			timeline, err = s.query.GetTimeline(ctx, pr)
+			return err
+		},
+		func(r *record) {
+			if timeline == nil {
+				timeline = []*github.Timeline{}
+			}
+			r.Timeline = timeline
+		})
+	return timeline, err
+}
+
+func (s *source) IsMerged(ctx context.Context, pr *github.PullRequest) (bool, error) {
+	var merged bool
+	err := s.recall(ctx, pr,
+		func(r *record) bool {
+			if r.Merged == nil {
+				return false
+			}
+			merged = *r.Merged
+			return true
+		},
+		func() (err error) {
+			merged, err = s.query.IsMerged(ctx, pr)
+			return err
+		},
+		func(r *record) {
+			r.Merged = &merged
+		})
+	return merged, err
+}
@@ -0,0 +1,239 @@
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dhellmann/gh-review-stats/util"
+)
+
+func TestResume(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path+"?"+r.URL.Query().Get("page")]++
+		count := requests[r.URL.Path+"?"+r.URL.Query().Get("page")]
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/repos/o/r/pulls":
+			if r.URL.Query().Get("page") == "2" {
+				w.Write([]byte(`[{"number": 1, "html_url": "u1", "base": {"repo": {"name": "r"}}}]`))
+				return
+			}
+			w.Header().Set("Link", `<`+r.URL.Path+`?page=2>; rel="next"`)
+			w.Write([]byte(`[
+				{"number": 3, "html_url": "u3", "base": {"repo": {"name": "r"}}},
+				{"number": 2, "html_url": "u2", "base": {"repo": {"name": "r"}}}
+			]`))
+		case "/repos/o/r/pulls/1/merge", "/repos/o/r/pulls/2/merge", "/repos/o/r/pulls/3/merge":
+			http.NotFound(w, r)
+		case "/repos/o/r/issues/1/comments":
+			// The first attempt fails.
+			if count == 1 {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`[]`))
+		default:
+			w.Write([]byte(`[]`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	path := filepath.Join(t.TempDir(), "checkpoint.json.gz")
+	ctx := context.Background()
+
+	first := New(path, "o", []string{"r"}, time.Time{})
+	first.Interval = 0
+	seen := []int{}
+	source := first.Source(&util.PullRequestQuery{Org: "o", Repos: []string{"r"}, Client: client})
+	err := source.IteratePullRequests(ctx, func(ctx context.Context, pr *github.PullRequest) error {
+		seen = append(seen, pr.GetNumber())
+		_, err := source.GetIssueComments(ctx, pr)
+		return err
+	})
+	// The failure is logged and the pull request is left pending.
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 2, 1}, seen)
+	require.NoError(t, first.Save())
+
+	resumed, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, resumed.Count())
+	seen = []int{}
+	source = resumed.Source(&util.PullRequestQuery{Org: "o", Repos: []string{"r"}, Client: client})
+	err = source.IteratePullRequests(ctx, func(ctx context.Context, pr *github.PullRequest) error {
+		seen = append(seen, pr.GetNumber())
+		_, err := source.GetIssueComments(ctx, pr)
+		return err
+	})
+	require.NoError(t, err)
+	sort.Ints(seen)
+	assert.Equal(t, []int{1, 2, 3}, seen)
+	assert.Equal(t, 3, resumed.Count())
+
+	// The first page and the details of the pull requests on it
+	// were not fetched again, and the details the callback did not
+	// ask for were not fetched at all.
+	assert.Equal(t, 1, requests["/repos/o/r/pulls?"])
+	assert.Equal(t, 1, requests["/repos/o/r/issues/3/comments?"])
+	assert.Equal(t, 2, requests["/repos/o/r/issues/1/comments?"])
+	assert.Equal(t, 0, requests["/repos/o/r/pulls/3/merge?"])
+	assert.Equal(t, 0, requests["/repos/o/r/pulls/3/reviews?"])
+
+	require.NoError(t, resumed.Remove())
+	_, err = Load(path)
+	assert.Error(t, err)
+}
+
+func TestResumeInterrupted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/o/r/pulls":
+			w.Write([]byte(`[{"number": 1, "html_url": "u1", "base": {"repo": {"name": "r"}}}]`))
+		case "/repos/o/r/pulls/1/comments":
+			if r.URL.Query().Get("page") == "2" {
+				w.Write([]byte(`[{"id": 2}]`))
+				return
+			}
+			w.Header().Set("Link", `<`+r.URL.Path+`?page=2>; rel="next"`)
+			w.Write([]byte(`[{"id": 1}]`))
+		default:
+			w.Write([]byte(`[]`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	// The run is interrupted once the first page of comments has
+	// been read.
+	var cancel context.CancelFunc
+	client := github.NewClient(&http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		response, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil || cancel == nil || r.URL.Path != "/repos/o/r/pulls/1/comments" {
+			return response, err
+		}
+		body, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		response.Body = io.NopCloser(bytes.NewReader(body))
+		cancel()
+		return response, err
+	})})
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	path := filepath.Join(t.TempDir(), "checkpoint.json.gz")
+	iterate := func(ctx context.Context, c *Checkpoint) []int {
+		counts := []int{}
+		source := c.Source(&util.PullRequestQuery{Org: "o", Repos: []string{"r"}, Client: client})
+		err := source.IteratePullRequests(ctx, func(ctx context.Context, pr *github.PullRequest) error {
+			comments, err := source.GetPRComments(ctx, pr)
+			counts = append(counts, len(comments))
+			return err
+		})
+		require.NoError(t, err)
+		return counts
+	}
+
+	ctx, cancelFirst := context.WithCancel(context.Background())
+	cancel = cancelFirst
+	first := New(path, "o", []string{"r"}, time.Time{})
+	assert.Equal(t, []int{1}, iterate(ctx, first))
+	assert.Equal(t, 0, first.Count())
+	require.NoError(t, first.Save())
+
+	// The partial comments were not saved, so they are read again in
+	// full.
+	cancel = nil
+	resumed, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, 0, resumed.Count())
+	assert.Equal(t, []int{2}, iterate(context.Background(), resumed))
+	assert.Equal(t, 1, resumed.Count())
+}
+
+func TestSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json.gz")
+	c := New(path, "o", []string{"r"}, time.Time{})
+	s := &source{checkpoint: c}
+	pr := func(number int) *github.PullRequest {
+		return &github.PullRequest{
+			Number:  github.Int(number),
+			HTMLURL: github.String("u"),
+			Base:    &github.PullRequestBranch{Repo: &github.Repository{Name: github.String("r")}},
+		}
+	}
+	merged := func(ctx context.Context, pr *github.PullRequest) error {
+		return s.recall(ctx, pr,
+			func(r *record) bool { return false },
+			func() error { return nil },
+			func(r *record) { r.Merged = github.Bool(true) })
+	}
+	leftOut := func(ctx context.Context, pr *github.PullRequest) error {
+		return util.ErrLeftOut
+	}
+	ctx := context.Background()
+
+	require.NoError(t, s.run(ctx, pr(1), merged))
+	require.NoError(t, c.Save())
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	// Later saves only append what changed since.
+	assert.Equal(t, util.ErrLeftOut, s.run(ctx, pr(2), leftOut))
+	require.NoError(t, c.Save())
+	appended, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Greater(t, appended.Size(), info.Size())
+	require.NoError(t, c.Save())
+	unchanged, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, appended.Size(), unchanged.Size())
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, loaded.Count())
+	assert.True(t, *loaded.processed[util.PRKey{Repo: "r", Number: 1}].Merged)
+	assert.Nil(t, loaded.processed[util.PRKey{Repo: "r", Number: 1}].Reviews)
+	assert.Nil(t, loaded.processed[util.PRKey{Repo: "r", Number: 2}].Merged)
+	assert.False(t, loaded.rewrite)
+
+	// A save interrupted part way through is dropped, and the next
+	// save writes the whole file again.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0x1f, 0x8b, 0x08})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	loaded, err = Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, loaded.Count())
+	assert.True(t, loaded.rewrite)
+	require.NoError(t, loaded.Save())
+	loaded, err = Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, loaded.Count())
+	assert.False(t, loaded.rewrite)
+}
+
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2022 Doug Hellmann <doug@doughellmann.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dhellmann/gh-review-stats/util"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the API response cache",
+}
+
+// newCachePruneCommand creates a cache prune command
+func newCachePruneCommand() *cobra.Command {
+	var olderThan time.Duration
+
+	var cachePruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Remove old entries from the API response cache",
+		Long: `Remove entries from the API response cache that have not been used recently.
+
+Use --older-than 0 to remove every entry.
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cacheDir == "" {
+				return errors.New("Missing required option --cache-dir")
+			}
+			removed, err := util.NewCache(cacheDir).Prune(olderThan)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("removed %d entries from %s\n", removed, cacheDir)
+			return nil
+		},
+	}
+
+	cachePruneCmd.Flags().DurationVar(&olderThan, "older-than", 30*24*time.Hour,
+		"remove entries not used for this long")
+
+	return cachePruneCmd
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(newCachePruneCommand())
+}
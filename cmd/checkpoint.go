@@ -0,0 +1,151 @@
+/*
+Copyright © 2022 Doug Hellmann <doug@doughellmann.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/dhellmann/gh-review-stats/checkpoint"
+	"github.com/dhellmann/gh-review-stats/util"
+)
+
+// partialNotice marks the reports of interrupted runs
+const partialNotice = "PARTIAL REPORT: the run was interrupted before all pull requests were processed"
+
+// resume continues from the checkpoint saved by an interrupted run
+var resume bool
+
+// checkpointPath returns the file holding the checkpoint of a
+// command for the organization
+func checkpointPath(name string) string {
+	dir := cacheDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "checkpoints", fmt.Sprintf("%s-%s.json.gz", name, orgName))
+}
+
+// newResumableSource returns the source of the pull requests for a
+// command, like newPullRequestSource. Pull requests read from GitHub
+// are saved in a checkpoint as they are processed, so an interrupted
+// run can be continued with --resume. The checkpoint is nil for the
+// other sources.
+func newResumableSource(ctx context.Context, name string, since time.Time) (util.PullRequestSource, *checkpoint.Checkpoint, error) {
+	if snapshotFile != "" || dbFile != "" {
+		if resume {
+			return nil, nil, errors.New("--resume cannot be combined with --from-snapshot or --from-db")
+		}
+		source, err := newPullRequestSource(ctx, since)
+		return source, nil, err
+	}
+
+	query, err := newPullRequestQuery(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resume && isSample() && sampleSeed == 0 {
+		// A new seed would draw a different sample from the one
+		// saved so far.
+		return nil, nil, errors.New("--resume with --sample needs the --sample-seed of the interrupted run")
+	}
+
+	path := checkpointPath(name)
+	_, statErr := os.Stat(path)
+	exists := statErr == nil
+
+	var cp *checkpoint.Checkpoint
+	switch {
+	case resume && exists:
+		cp, err = checkpoint.Load(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cp.Org() != orgName || !reflect.DeepEqual(cp.Repos(), query.Repos) {
+			return nil, nil, fmt.Errorf("the checkpoint in %s is for %s/%s, not the repositories selected now",
+				path, cp.Org(), strings.Join(cp.Repos(), ","))
+		}
+		// Keep the date range of the interrupted run so the pages
+		// listed already line up.
+		since = cp.Since()
+		logger.Info("resuming from checkpoint", "path", path, "pull_requests", cp.Count())
+	case resume:
+		logger.Warn("there is no checkpoint, starting from the beginning", "path", path)
+		cp = checkpoint.New(path, orgName, query.Repos, since)
+	default:
+		if exists {
+			logger.Warn("replacing the checkpoint of an interrupted run, use --resume to continue it instead",
+				"path", path)
+		}
+		cp = checkpoint.New(path, orgName, query.Repos, since)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, nil, errors.Wrap(err, "could not create the checkpoint directory")
+	}
+
+	cp.Log = logger
+	query.Since = since
+	return cp.Source(query), cp, nil
+}
+
+// finishCheckpoint saves the checkpoint when the run was interrupted
+// or failed, so it can be resumed, and removes it when the run is
+// complete. It returns true if the run was interrupted and the
+// report is partial.
+func finishCheckpoint(ctx context.Context, cp *checkpoint.Checkpoint, iterateErr error) bool {
+	interrupted := ctx.Err() != nil
+	if cp == nil {
+		return interrupted
+	}
+	if !interrupted && iterateErr == nil {
+		if err := cp.Remove(); err != nil {
+			logger.Warn("could not remove checkpoint", "err", err)
+		}
+		return false
+	}
+	if err := cp.Save(); err != nil {
+		logger.Error("could not save checkpoint", "err", err)
+		return interrupted
+	}
+	again := "--resume"
+	if isSample() {
+		again = fmt.Sprintf("--resume --sample-seed %d", selection.Sample.Seed)
+	}
+	logger.Info("saved checkpoint, run again to continue", "path", cp.Path,
+		"pull_requests", cp.Count(), "flags", again)
+	return interrupted
+}
+
+// reportPartial marks a report as partial
+func reportPartial(report io.Writer, partial bool) {
+	if partial {
+		fmt.Fprintf(report, "%s\n\n", partialNotice)
+	}
+}
+
+func addResumeArgs(theCommand *cobra.Command) {
+	theCommand.Flags().BoolVar(&resume, "resume", false,
+		"continue from where an interrupted run of the command stopped")
+}
@@ -0,0 +1,117 @@
+/*
+Copyright © 2022 Doug Hellmann <doug@doughellmann.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/dhellmann/gh-review-stats/snapshot"
+	"github.com/dhellmann/gh-review-stats/util"
+)
+
+func init() {
+	var outputFileName string
+
+	var exportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Save pull requests and their details to a snapshot file",
+		Long: `Fetch pull requests with their reviews, comments, and commits and
+save them to a compressed JSON file.
+
+The file can be given to the other commands with --from-snapshot to
+produce reports without using the GitHub API.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if snapshotFile != "" || dbFile != "" {
+				return errors.New("export reads from GitHub and cannot be combined with --from-snapshot or --from-db")
+			}
+			cobra.CheckErr(checkSourceOptions())
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+
+			var earliestDate time.Time
+			if daysBack > 0 {
+				earliestDate = time.Now().AddDate(0, 0, daysBack*-1)
+			}
+
+			source, cp, err := newResumableSource(ctx, cmd.Name(), earliestDate)
+			if err != nil {
+				return err
+			}
+
+			snap := snapshot.New(orgName, source.Repositories(), cp.Since())
+			var mu sync.Mutex
+			failures := newFailures()
+			err = failures.Iterate(ctx, source, func(ctx context.Context, pr *github.PullRequest) error {
+				fetched, err := util.Fetch(ctx, source, pr)
+				if err != nil {
+					return err
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				snap.PullRequests = append(snap.PullRequests, fetched)
+				return nil
+			})
+			snap.Partial = finishCheckpoint(ctx, cp, err)
+			if isSample() {
+				snap.Sample = selection.Sample.String()
+			}
+			if err != nil {
+				return errors.Wrap(err, "failed to retrieve pull request details")
+			}
+
+			// Save the pull requests in a predictable order, no matter
+			// what order they were processed in.
+			sort.Slice(snap.PullRequests, func(i, j int) bool {
+				a, b := util.KeyFor(snap.PullRequests[i].Pull), util.KeyFor(snap.PullRequests[j].Pull)
+				if a.Repo != b.Repo {
+					return a.Repo < b.Repo
+				}
+				return a.Number > b.Number
+			})
+
+			if outputFileName == "" {
+				outputFileName = fmt.Sprintf("%s-%s.json.gz", orgName,
+					snap.CreatedAt.Format("20060102-150405"))
+			}
+			if err := snap.Save(outputFileName); err != nil {
+				return err
+			}
+			logger.Info("wrote snapshot", "path", outputFileName, "pull_requests", len(snap.PullRequests))
+			reportPartial(os.Stderr, snap.Partial)
+			reportSample(os.Stderr)
+			return reportFailures(os.Stderr, failures)
+		},
+	}
+
+	addHistoryArgs(exportCmd)
+	addResumeArgs(exportCmd)
+	addSelectionArgs(exportCmd)
+	exportCmd.Flags().StringVarP(&outputFileName, "output", "O", "",
+		"snapshot file to create (defaults to <org>-<date>-<time>.json.gz)")
+
+	rootCmd.AddCommand(exportCmd)
+}
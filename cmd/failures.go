@@ -0,0 +1,51 @@
+/*
+Copyright © 2022 Doug Hellmann <doug@doughellmann.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dhellmann/gh-review-stats/util"
+)
+
+// failFast stops a command at the first pull request that cannot be
+// processed, instead of skipping it
+var failFast bool
+
+// newFailures returns a tracker for the pull requests a command
+// cannot process, using the global options
+func newFailures() *util.Failures {
+	return &util.Failures{FailFast: failFast, Log: logger}
+}
+
+// reportFailures lists the pull requests that were skipped on
+// stderr, writes the data completeness line to the report, and
+// returns an error if anything was skipped so the command exits with
+// a non-zero status
+func reportFailures(report io.Writer, failures *util.Failures) error {
+	failures.WriteSummary(os.Stderr)
+	fmt.Fprintf(report, "\n%s\n", failures.Completeness())
+	if err := failures.Err(); err != nil {
+		// Skipped pull requests are not a problem with how the
+		// command was used, and Execute prints the error.
+		rootCmd.SilenceUsage = true
+		rootCmd.SilenceErrors = true
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright © 2022 Doug Hellmann <doug@doughellmann.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/dhellmann/gh-review-stats/graph"
+)
+
+func init() {
+	var outputFileName string
+	var outputFormat string
+	var minWeight int
+
+	var graphCmd = &cobra.Command{
+		Use:   "graph",
+		Short: "Export a graph of who reviews whose pull requests",
+		Long: `Produce a weighted directed graph with an edge from each reviewer to
+the authors of the pull requests they reviewed or commented on. The
+weight of an edge is the number of reviews and comments.
+
+The graph can be written as Graphviz DOT, GraphML, or JSON.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var write func(*graph.Graph, io.Writer) error
+			switch outputFormat {
+			case "dot":
+				write = (*graph.Graph).WriteDOT
+			case "graphml":
+				write = (*graph.Graph).WriteGraphML
+			case "json":
+				write = (*graph.Graph).WriteJSON
+			default:
+				return fmt.Errorf("unknown --format %q, expected \"dot\", \"graphml\", or \"json\"", outputFormat)
+			}
+			cobra.CheckErr(checkSourceOptions())
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+
+			failures := newFailures()
+			reviewerStats, partial, err := collectReviewerStats(ctx, cmd.Name(), failures)
+			if err != nil {
+				return err
+			}
+			// The graph formats have no room for the notice, so it
+			// goes to stderr.
+			reportPartial(os.Stderr, partial)
+			reportSample(os.Stderr)
+
+			// Ignored accounts and bots are left out, whether they
+			// are reviewing or authoring.
+			g := graph.New(reviewerStats.Interactions(), minWeight)
+
+			out := io.Writer(os.Stdout)
+			if outputFileName != "" {
+				outFile, err := os.Create(outputFileName)
+				if err != nil {
+					return errors.Wrap(err, "could not create output file")
+				}
+				defer outFile.Close()
+				logger.Info("writing graph", "path", outputFileName)
+				out = outFile
+			}
+			if err := write(g, out); err != nil {
+				return err
+			}
+			// The graph may be going to stdout, so the completeness
+			// of the data goes to stderr.
+			return reportFailures(os.Stderr, failures)
+		},
+	}
+
+	addHistoryArgs(graphCmd)
+	addIncludeBotsArgs(graphCmd)
+	addResumeArgs(graphCmd)
+	addSelectionArgs(graphCmd)
+	graphCmd.Flags().StringVarP(&outputFileName, "output", "O", "",
+		"output file to create (defaults to stdout)")
+	graphCmd.Flags().StringVar(&outputFormat, "format", "dot",
+		"output format, \"dot\", \"graphml\", or \"json\"")
+	graphCmd.Flags().IntVar(&minWeight, "min-weight", 1,
+		"leave out edges with fewer reviews and comments than this")
+
+	rootCmd.AddCommand(graphCmd)
+}
@@ -0,0 +1,45 @@
+/*
+Copyright © 2022 Doug Hellmann <doug@doughellmann.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/spf13/viper"
+
+	"github.com/dhellmann/gh-review-stats/identity"
+)
+
+const identitiesConfigOptionName = "identities"
+
+// identityMap is the map built from the configuration, created the
+// first time it is needed
+var identityMap *identity.Map
+
+// identities returns the map of the different logins, names, and
+// email addresses people use, from the configuration file
+func identities() *identity.Map {
+	if identityMap == nil {
+		people := []identity.Person{}
+		if err := viper.UnmarshalKey(identitiesConfigOptionName, &people); err != nil {
+			logger.Warn("could not read identities", "setting", identitiesConfigOptionName, "err", err)
+		}
+		identityMap = identity.New(people)
+	}
+	return identityMap
+}
+
+func init() {
+	viper.SetDefault(identitiesConfigOptionName, []interface{}{})
+}
@@ -0,0 +1,56 @@
+/*
+Copyright © 2022 Doug Hellmann <doug@doughellmann.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dhellmann/gh-review-stats/logging"
+	"github.com/dhellmann/gh-review-stats/util"
+)
+
+// logLevel and logFormat control which messages are logged and how
+var logLevel, logFormat string
+
+// logger records what the commands are doing on stderr, shared by
+// all of the clients, queries, and reports
+var logger *logging.Logger
+
+// initLogging sets up the progress and the logger from the global
+// options. The log messages are written through the progress so they
+// do not break up its status line.
+func initLogging() {
+	level, err := logging.ParseLevel(logLevel)
+	cobra.CheckErr(err)
+
+	var out io.Writer = os.Stderr
+	if !quiet {
+		progress = util.NewProgress(os.Stderr)
+		out = progress
+	}
+	logger, err = logging.New(out, level, logFormat)
+	cobra.CheckErr(err)
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info",
+		"least important messages to log, \"debug\", \"info\", \"warn\", or \"error\"")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", logging.FormatText,
+		"format of the log messages, \"text\" or \"json\"")
+}
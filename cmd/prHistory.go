@@ -24,6 +24,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dhellmann/gh-review-stats/events"
 	"github.com/dhellmann/gh-review-stats/stats"
@@ -39,9 +40,12 @@ type keyCount struct {
 
 // prHistoryCmd represents the prHistory command
 var prHistoryCmd = &cobra.Command{
-	Use:       "pr-history pull-request-id...",
-	Short:     "Summarize the history of one pull request",
-	Long:      `Produce stats and a history log of one pull request`,
+	Use:   "pr-history pull-request-id...",
+	Short: "Summarize the history of one pull request",
+	Long: `Produce stats and a history log of one pull request
+
+Pull requests are identified by number when a single repository is
+given with --repo, or as repo#number otherwise.`,
 	ValidArgs: []string{"pull-request"},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) < 1 {
@@ -52,17 +56,20 @@ var prHistoryCmd = &cobra.Command{
 		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 		defer stop()
 
-		query := &util.PullRequestQuery{
-			Org:     orgName,
-			Repo:    repoName,
-			DevMode: devMode,
-			Client:  util.NewGithubClient(ctx, githubToken()),
+		cobra.CheckErr(checkSourceOptions())
+
+		source, repos, err := newPullRequestLookup(ctx)
+		if err != nil {
+			return err
 		}
 
 		prStats := &stats.Stats{
-			Query: query,
+			Query:      source,
+			Identities: identities(),
+			Log:        logger,
 			Buckets: []*stats.Bucket{
 				{
+					Name: "all",
 					Rule: func(*stats.PullRequestDetails) bool {
 						return true
 					},
@@ -70,32 +77,46 @@ var prHistoryCmd = &cobra.Command{
 			},
 		}
 
-		toIgnore := reviewersToIgnore()
+		ignore, err := peopleToIgnore()
+		if err != nil {
+			return err
+		}
 
 		// fetch all of the event data for all pull requests
+		failures := newFailures()
+		processOne := failures.Wrap(prStats.ProcessOne)
 		for _, arg := range args {
-			prID, err := strconv.Atoi(arg)
+			// An interrupted run reports on the pull requests
+			// processed so far.
+			if ctx.Err() != nil {
+				break
+			}
+
+			repo, prID, err := parsePullRequestID(arg, repos)
 			if err != nil {
-				return errors.Wrap(err, "pull-request-id must be a number")
+				return err
 			}
 
-			pr, _, err := query.Client.PullRequests.Get(ctx, orgName, repoName, prID)
+			pr, err := source.GetPullRequest(ctx, repo, prID)
 			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
 				return errors.Wrap(err, "failed to fetch pull request")
 			}
-			prStats.ProcessOne(ctx, pr)
-
-			select {
-			case <-ctx.Done():
-				return nil
-			default:
+			if err := processOne(ctx, pr); err != nil {
+				return err
 			}
 		}
+		if err := failures.Retry(ctx, prStats.ProcessOne); err != nil {
+			return err
+		}
+		reportPartial(os.Stdout, ctx.Err() != nil)
 
 		// merge the events into a single stream
 		allEvents := []*events.Event{}
 		for _, prd := range prStats.Buckets[0].Requests {
-			events := events.GetOrderedEvents(prd)
+			events := events.GetOrderedEvents(prd, identities())
 			allEvents = append(allEvents, events...)
 		}
 		sort.Slice(allEvents, func(i, j int) bool {
@@ -111,7 +132,7 @@ var prHistoryCmd = &cobra.Command{
 		// show the event log
 		var previous *events.Event
 		for _, e := range allEvents {
-			if _, ok := toIgnore[e.Person]; ok {
+			if ignore.Account(e.Person, e.Bot) {
 				continue
 			}
 
@@ -144,7 +165,7 @@ var prHistoryCmd = &cobra.Command{
 			if person == "" {
 				continue
 			}
-			if _, ok := toIgnore[person]; ok {
+			if ignore.Name(person) {
 				continue
 			}
 			pairs = append(pairs, keyCount{
@@ -185,13 +206,69 @@ var prHistoryCmd = &cobra.Command{
 			fmt.Printf("%s: %3d %s\n", p.Key, p.Count, bar)
 		}
 
-		return nil
+		return reportFailures(os.Stdout, failures)
 	},
 }
 
+// newPullRequestLookup returns the source to look pull requests up
+// in, and a function returning the repositories a bare pull request
+// number may belong to. When reading from GitHub, the repositories of
+// the org are only listed if a bare number needs them.
+func newPullRequestLookup(ctx context.Context) (util.PullRequestSource, func() ([]string, error), error) {
+	if snapshotFile != "" || dbFile != "" {
+		source, err := newPullRequestSource(ctx, time.Time{})
+		if err != nil {
+			return nil, nil, err
+		}
+		return source, func() ([]string, error) { return source.Repositories(), nil }, nil
+	}
+
+	query, err := newUnlistedPullRequestQuery(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	repos := func() ([]string, error) {
+		if query.Repos == nil {
+			names, err := selectRepositories(ctx, query.Client)
+			if err != nil {
+				return nil, err
+			}
+			query.Repos = names
+		}
+		return query.Repos, nil
+	}
+	return query, repos, nil
+}
+
+// parsePullRequestID splits an argument of the form repo#number, or
+// just a number if there is only one repository, into its parts. The
+// repositories are only looked up for a bare number.
+func parsePullRequestID(arg string, repos func() ([]string, error)) (string, int, error) {
+	repo, number := "", arg
+	if i := strings.LastIndex(arg, "#"); i >= 0 {
+		repo, number = arg[:i], arg[i+1:]
+	} else {
+		names, err := repos()
+		if err != nil {
+			return "", 0, err
+		}
+		if len(names) != 1 {
+			return "", 0, fmt.Errorf(
+				"pull-request-id %q must be given as repo#number when using more than one repository", arg)
+		}
+		repo = names[0]
+	}
+	prID, err := strconv.Atoi(number)
+	if err != nil {
+		return "", 0, errors.Wrap(err, "pull-request-id must be a number")
+	}
+	return repo, prID, nil
+}
+
 func init() {
 	rootCmd.AddCommand(prHistoryCmd)
 	addHistoryArgs(prHistoryCmd)
+	addIncludeBotsArgs(prHistoryCmd)
 
 	// Here you will define your flags and configuration settings.
 
@@ -19,15 +19,16 @@ import (
 	"context"
 	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"strings"
 	"time"
 
 	"github.com/dhellmann/gh-review-stats/stats"
+	"github.com/dhellmann/gh-review-stats/teams"
 	"github.com/dhellmann/gh-review-stats/util"
 
-	"github.com/google/go-github/v45/github"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -37,6 +38,7 @@ const dateFmt = "2006-01-02"
 // newPullRequestsCmd creates a pullRequests command
 func newPullRequestsCommand() *cobra.Command {
 	var outputFileName string
+	var botsOutputFileName string
 	var includeAll bool
 
 	var pullRequestsCmd = &cobra.Command{
@@ -44,27 +46,41 @@ func newPullRequestsCommand() *cobra.Command {
 		Short: "List pull requests and some characteristics in CSV format",
 		Long:  `Produce a CSV list of pull requests suitable for import into a spreadsheet.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if orgName == "" {
-				cobra.CheckErr(errors.New("Missing required option --org"))
-			}
-			if repoName == "" {
-				cobra.CheckErr(errors.New("Missing required option --repo"))
-			}
-			if githubToken() == "" {
-				cobra.CheckErr(errors.New("Missing GitHub token"))
-			}
+			cobra.CheckErr(checkSourceOptions())
+			cobra.CheckErr(checkGroupByOptions())
 
 			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 			defer stop()
 
-			query := &util.PullRequestQuery{
-				Org:     orgName,
-				Repo:    repoName,
-				DevMode: devMode,
-				Client:  util.NewGithubClient(ctx, githubToken()),
+			var memberTeams *teams.Teams
+			if groupBy == groupByTeam {
+				var err error
+				memberTeams, err = loadTeams(ctx)
+				if err != nil {
+					return err
+				}
+			}
+
+			ignore, err := peopleToIgnore()
+			if err != nil {
+				return err
+			}
+
+			// Pull requests by bots and ignored accounts are
+			// reported separately.
+			bots := stats.Bucket{
+				Name: "bots",
+				Rule: func(prd *stats.PullRequestDetails) bool {
+					if !includeAll && prd.State != "merged" {
+						return false
+					}
+					return ignore.User(prd.Pull.User)
+				},
+				Cascade: false,
 			}
 
 			all := stats.Bucket{
+				Name: "all",
 				Rule: func(prd *stats.PullRequestDetails) bool {
 
 					if !includeAll && prd.State != "merged" {
@@ -79,26 +95,29 @@ func newPullRequestsCommand() *cobra.Command {
 			var earliestDate time.Time
 			if daysBack > 0 {
 				earliestDate = time.Now().AddDate(0, 0, daysBack*-1)
-				fmt.Fprintf(os.Stderr, "including data since %s\n",
-					earliestDate.Format("2006-01-02"))
+				logger.Info("including data since", "date", earliestDate.Format("2006-01-02"))
+			}
+
+			failures := newFailures()
+			source, cp, err := newResumableSource(ctx, cmd.Name(), earliestDate)
+			if err != nil {
+				return err
 			}
 
 			theStats := &stats.Stats{
-				Query:        query,
+				Query:        source,
+				Identities:   identities(),
 				EarliestDate: earliestDate,
-				Buckets:      []*stats.Bucket{&all},
+				Buckets:      []*stats.Bucket{&bots, &all},
+				Failures:     failures,
+				Log:          logger,
 			}
-			err := theStats.Populate(ctx)
+			err = theStats.Populate(ctx)
+			partial := finishCheckpoint(ctx, cp, err)
 			if err != nil {
 				return errors.Wrap(err, "could not generate stats")
 			}
 
-			select {
-			case <-ctx.Done():
-				return nil
-			default:
-			}
-
 			var out *csv.Writer
 			if outputFileName == "" {
 				out = csv.NewWriter(os.Stdout)
@@ -106,92 +125,250 @@ func newPullRequestsCommand() *cobra.Command {
 				outFile, err := os.Create(outputFileName)
 				cobra.CheckErr(errors.Wrap(err, "could not create output file"))
 				defer outFile.Close()
-				fmt.Fprintf(os.Stderr, "writing to %s\n", outputFileName)
+				logger.Info("writing report", "path", outputFileName)
 				out = csv.NewWriter(outFile)
 			}
 
-			out.Write([]string{
-				"ID",
-				"Title",
-				"State",
-				"Author",
-				"URL",
-				"Created",
-				"Closed",
-				"Days Open",
-				"Review Activity",
-			})
+			if err := writeBotPullRequests(botsOutputFileName, bots.Requests); err != nil {
+				return err
+			}
+
+			if memberTeams != nil {
+				writeTeamSummaries(out, memberTeams.Summarize(all.Requests, identities()))
+				reportPartial(progress, partial)
+				reportSample(progress)
+				return reportFailures(progress, failures)
+			}
 
-			for _, prd := range all.Requests {
+			out.Write(pullRequestColumns)
 
-				var (
-					createdAt, closedAt string
-					daysOpen            int = -1
-				)
+			var toReview, toComment, toApproval []time.Duration
 
-				if prd.Pull.CreatedAt != nil {
-					createdAt = prd.Pull.CreatedAt.Format(dateFmt)
-				}
-				if prd.Pull.ClosedAt != nil {
-					closedAt = prd.Pull.ClosedAt.Format(dateFmt)
+			for _, prd := range all.Requests {
+				out.Write(pullRequestRow(prd))
+
+				if prd.TimeToFirstReview != nil {
+					toReview = append(toReview, *prd.TimeToFirstReview)
 				}
-				if prd.Pull.CreatedAt != nil {
-					if prd.State == "merged" && prd.Pull.ClosedAt != nil {
-						daysOpen = int(prd.Pull.ClosedAt.Sub(*prd.Pull.CreatedAt).Hours() / 24)
-					} else {
-						daysOpen = int(time.Since(*prd.Pull.CreatedAt).Hours() / 24)
-					}
+				if prd.TimeToFirstComment != nil {
+					toComment = append(toComment, *prd.TimeToFirstComment)
 				}
-
-				user := getName(prd.Pull.User)
-
-				out.Write([]string{
-					fmt.Sprintf("%d", *prd.Pull.Number),
-					strings.TrimSpace(*prd.Pull.Title),
-					prd.State,
-					user,
-					*prd.Pull.HTMLURL,
-					createdAt,
-					closedAt,
-					fmt.Sprintf("%d", daysOpen),
-					fmt.Sprintf("%d", prd.AllActivityCount),
-				})
-
-				out.Flush()
-
-				select {
-				case <-ctx.Done():
-					return nil
-				default:
+				if prd.TimeToFirstApproval != nil {
+					toApproval = append(toApproval, *prd.TimeToFirstApproval)
 				}
 			}
+			out.Flush()
 
-			return nil
+			// The CSV may be going to stdout, so the summary and the
+			// notices go to stderr. They are part of the report
+			// rather than log messages, but are written through the
+			// progress so they do not run into its status line.
+			fmt.Fprintf(progress, "\nresponse times for %d pull requests:\n", len(all.Requests))
+			printDurationSummary(progress, "first review", stats.SummarizeDurations(toReview))
+			printDurationSummary(progress, "first comment", stats.SummarizeDurations(toComment))
+			printDurationSummary(progress, "first approval", stats.SummarizeDurations(toApproval))
+
+			fmt.Fprintln(progress)
+			reportPartial(progress, partial)
+			reportSample(progress)
+			return reportFailures(progress, failures)
 		},
 	}
 
 	addHistoryArgs(pullRequestsCmd)
+	addGroupByArgs(pullRequestsCmd)
+	addSelectionArgs(pullRequestsCmd)
 	pullRequestsCmd.Flags().StringVarP(&outputFileName, "output", "O", "",
 		"output file to create (defaults to stdout)")
 	pullRequestsCmd.Flags().BoolVar(&includeAll, "all", false,
 		"include all PRs, not just merged")
+	pullRequestsCmd.Flags().StringVar(&botsOutputFileName, "bots-output", "",
+		"output file to create for the PRs by bots and ignored accounts, which are otherwise left out")
+	addIncludeBotsArgs(pullRequestsCmd)
+	addResumeArgs(pullRequestsCmd)
 
 	return pullRequestsCmd
 }
 
-func getName(user *github.User) string {
-	if user == nil {
-		return "unnamed"
+func init() {
+	rootCmd.AddCommand(newPullRequestsCommand())
+}
+
+// pullRequestColumns are the headings of the pull request report
+var pullRequestColumns = []string{
+	"Repository",
+	"ID",
+	"Title",
+	"State",
+	"Author",
+	"URL",
+	"Created",
+	"Closed",
+	"Days Open",
+	"Review Activity",
+	"Hours to First Review",
+	"Hours to First Comment",
+	"Hours to First Approval",
+}
+
+// pullRequestRow returns the values for one pull request in the
+// report
+func pullRequestRow(prd *stats.PullRequestDetails) []string {
+	var (
+		createdAt, closedAt string
+		daysOpen            int = -1
+	)
+
+	if prd.Pull.CreatedAt != nil {
+		createdAt = prd.Pull.CreatedAt.Format(dateFmt)
 	}
-	if user.Name != nil {
-		return *user.Name
+	if prd.Pull.ClosedAt != nil {
+		closedAt = prd.Pull.ClosedAt.Format(dateFmt)
 	}
-	if user.Login != nil {
-		return *user.Login
+	if prd.Pull.CreatedAt != nil {
+		if prd.State == "merged" && prd.Pull.ClosedAt != nil {
+			daysOpen = int(prd.Pull.ClosedAt.Sub(*prd.Pull.CreatedAt).Hours() / 24)
+		} else {
+			daysOpen = int(time.Since(*prd.Pull.CreatedAt).Hours() / 24)
+		}
+	}
+
+	user := identities().User(prd.Pull.User)
+
+	return []string{
+		util.RepoName(prd.Pull),
+		fmt.Sprintf("%d", *prd.Pull.Number),
+		strings.TrimSpace(*prd.Pull.Title),
+		prd.State,
+		user,
+		*prd.Pull.HTMLURL,
+		createdAt,
+		closedAt,
+		fmt.Sprintf("%d", daysOpen),
+		fmt.Sprintf("%d", prd.AllActivityCount),
+		formatHours(prd.TimeToFirstReview),
+		formatHours(prd.TimeToFirstComment),
+		formatHours(prd.TimeToFirstApproval),
 	}
-	return "unnamed"
 }
 
-func init() {
-	rootCmd.AddCommand(newPullRequestsCommand())
+// writeBotPullRequests writes the pull requests by bots and ignored
+// accounts to their own file, or reports how many were left out if
+// there is no file
+func writeBotPullRequests(outputFileName string, requests []*stats.PullRequestDetails) error {
+	if outputFileName == "" {
+		if len(requests) > 0 {
+			logger.Info("leaving out pull requests by bots and ignored accounts", "count", len(requests))
+		}
+		return nil
+	}
+	outFile, err := os.Create(outputFileName)
+	if err != nil {
+		return errors.Wrap(err, "could not create output file")
+	}
+	defer outFile.Close()
+	logger.Info("writing pull requests by bots and ignored accounts", "count", len(requests),
+		"path", outputFileName)
+	out := csv.NewWriter(outFile)
+	out.Write(pullRequestColumns)
+	for _, prd := range requests {
+		out.Write(pullRequestRow(prd))
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// writeTeamSummaries writes one row of the CSV for each team. When
+// the pull requests are a sample, the confidence intervals of the
+// medians are included.
+func writeTeamSummaries(out *csv.Writer, summaries []*teams.Summary) {
+	medianColumns := func(name string) []string {
+		if !isSample() {
+			return []string{name}
+		}
+		return []string{name, name + " 95% CI Low", name + " 95% CI High"}
+	}
+	medianValues := func(summary stats.DurationSummary) []string {
+		if !isSample() {
+			return []string{formatMedianHours(summary)}
+		}
+		if summary.Count == 0 {
+			return []string{"", "", ""}
+		}
+		return []string{formatHours(&summary.Median),
+			formatHours(&summary.MedianLow), formatHours(&summary.MedianHigh)}
+	}
+
+	header := []string{
+		"Team",
+		"Pull Requests",
+		"Merged",
+		"Review Activity",
+		"Reviews From Team",
+		"Reviews From Other Teams",
+	}
+	header = append(header, medianColumns("Median Hours to First Review")...)
+	header = append(header, medianColumns("Median Hours to First Approval")...)
+	out.Write(header)
+	for _, summary := range summaries {
+		row := []string{
+			summary.Team,
+			fmt.Sprintf("%d", summary.PullRequests),
+			fmt.Sprintf("%d", summary.Merged),
+			fmt.Sprintf("%d", summary.ReviewActivity),
+			fmt.Sprintf("%d", summary.ReviewsFromTeam),
+			fmt.Sprintf("%d", summary.ReviewsFromOtherTeams),
+		}
+		row = append(row, medianValues(summary.TimeToFirstReview)...)
+		row = append(row, medianValues(summary.TimeToFirstApproval)...)
+		out.Write(row)
+	}
+	out.Flush()
+}
+
+// formatMedianHours shows the median of the durations as a number
+// of hours for the CSV output, or an empty string if there are none
+func formatMedianHours(summary stats.DurationSummary) string {
+	if summary.Count == 0 {
+		return ""
+	}
+	return formatHours(&summary.Median)
+}
+
+// formatHours shows a duration as a number of hours for the CSV
+// output, or an empty string if there is no duration
+func formatHours(d *time.Duration) string {
+	if d == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.1f", d.Hours())
+}
+
+// formatDuration shows a duration rounded to a readable precision
+func formatDuration(d time.Duration) string {
+	if d >= 24*time.Hour {
+		return fmt.Sprintf("%.1fd", d.Hours()/24)
+	}
+	d = d.Round(time.Minute)
+	if d == 0 {
+		return "0m"
+	}
+	return strings.TrimSuffix(d.String(), "0s")
+}
+
+func printDurationSummary(out io.Writer, name string, summary stats.DurationSummary) {
+	if summary.Count == 0 {
+		fmt.Fprintf(out, "  %-15s none\n", name+":")
+		return
+	}
+	median := formatDuration(summary.Median)
+	if isSample() {
+		// Only part of the pull requests were seen, so show how
+		// far off the median might be.
+		median = fmt.Sprintf("%s (95%% CI %s-%s)", median,
+			formatDuration(summary.MedianLow), formatDuration(summary.MedianHigh))
+	}
+	fmt.Fprintf(out, "  %-15s %4d  median %-8s p75 %-8s p90 %s\n", name+":",
+		summary.Count, median,
+		formatDuration(summary.P75), formatDuration(summary.P90))
 }
@@ -0,0 +1,178 @@
+/*
+Copyright © 2022 Doug Hellmann <doug@doughellmann.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/dhellmann/gh-review-stats/snapshot"
+	"github.com/dhellmann/gh-review-stats/store"
+)
+
+func init() {
+	var outputFormat string
+
+	var queryCmd = &cobra.Command{
+		Use:   "query SQL",
+		Short: "Run a SQL query over saved pull requests",
+		Long: `Run a SQL query over the pull requests saved by the sync or export
+commands, given with --from-db or --from-snapshot.
+
+The tables are pull_requests, reviews, issue_comments,
+review_comments, commits, and timeline_events. Every table has repo
+and number columns identifying the pull request, and a data column
+with the full JSON from the GitHub API.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if outputFormat != "table" && outputFormat != "csv" && outputFormat != "json" {
+				return fmt.Errorf("unknown --format %q, expected \"table\", \"csv\", or \"json\"", outputFormat)
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+
+			db, err := openQueryStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			result, err := db.Query(ctx, args[0])
+			if err != nil {
+				return errors.Wrap(err, "query failed")
+			}
+
+			switch outputFormat {
+			case "csv":
+				return writeResultCSV(os.Stdout, result)
+			case "json":
+				return writeResultJSON(os.Stdout, result)
+			default:
+				return writeResultTable(os.Stdout, result)
+			}
+		},
+	}
+
+	queryCmd.Flags().StringVar(&outputFormat, "format", "table",
+		"output format, \"table\", \"csv\", or \"json\"")
+
+	rootCmd.AddCommand(queryCmd)
+}
+
+// openQueryStore returns a read only database to query, loading a
+// snapshot into a temporary in-memory database if needed
+func openQueryStore(ctx context.Context) (*store.Store, error) {
+	switch {
+	case dbFile != "":
+		return store.OpenReadOnly(dbFile)
+	case snapshotFile != "":
+		snap, err := snapshot.Load(snapshotFile)
+		if err != nil {
+			return nil, err
+		}
+		db, err := store.Open(":memory:")
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Import(ctx, snap.Source()); err != nil {
+			db.Close()
+			return nil, errors.Wrap(err, "could not load snapshot")
+		}
+		return db, nil
+	}
+	return nil, errors.New("query needs the --from-db or --from-snapshot option")
+}
+
+// formatValue converts a column value to a string for the table and
+// CSV formats
+func formatValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func writeResultTable(w io.Writer, result *store.Result) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(result.Columns, "\t"))
+	for _, row := range result.Rows {
+		values := make([]string, len(row))
+		for i, v := range row {
+			// Keep multi-line values, such as comment bodies, from
+			// breaking up the table.
+			values[i] = strings.ReplaceAll(formatValue(v), "\n", " ")
+		}
+		fmt.Fprintln(tw, strings.Join(values, "\t"))
+	}
+	return tw.Flush()
+}
+
+func writeResultCSV(w io.Writer, result *store.Result) error {
+	out := csv.NewWriter(w)
+	out.Write(result.Columns)
+	for _, row := range result.Rows {
+		values := make([]string, len(row))
+		for i, v := range row {
+			values[i] = formatValue(v)
+		}
+		out.Write(values)
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// writeResultJSON prints the rows as a list of objects, with the
+// keys in the same order as the columns
+func writeResultJSON(w io.Writer, result *store.Result) error {
+	buf := &bytes.Buffer{}
+	buf.WriteString("[")
+	for i, row := range result.Rows {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n  {")
+		for j, v := range row {
+			if j > 0 {
+				buf.WriteString(", ")
+			}
+			key, _ := json.Marshal(result.Columns[j])
+			value, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(buf, "%s: %s", key, value)
+		}
+		buf.WriteString("}")
+	}
+	if len(result.Rows) > 0 {
+		buf.WriteString("\n")
+	}
+	buf.WriteString("]\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
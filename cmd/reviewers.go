@@ -21,9 +21,13 @@ import (
 	"os"
 	"os/signal"
 	"sort"
+	"strings"
 	"time"
 
+	"github.com/dhellmann/gh-review-stats/graph"
+	"github.com/dhellmann/gh-review-stats/identity"
 	"github.com/dhellmann/gh-review-stats/reviewers"
+	"github.com/dhellmann/gh-review-stats/teams"
 	"github.com/dhellmann/gh-review-stats/util"
 	"github.com/pkg/errors"
 
@@ -37,89 +41,165 @@ const ignoreConfigOptionName = "reviewers.ignore"
 // stats
 var ignoredReviewers = []string{}
 
+// includeBots turns off leaving bots out of the reports
+var includeBots bool
+
 // reviewersCmd represents the reviewers command
 var reviewersCmd = &cobra.Command{
 	Use:   "reviewers",
 	Short: "List reviewers of PRs in a repo",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if orgName == "" {
-			cobra.CheckErr(errors.New("Missing required option --org"))
-		}
-		if repoName == "" {
-			cobra.CheckErr(errors.New("Missing required option --repo"))
-		}
-		if githubToken() == "" {
-			cobra.CheckErr(errors.New("Missing GitHub token"))
-		}
+		cobra.CheckErr(checkSourceOptions())
+		cobra.CheckErr(checkGroupByOptions())
 
 		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 		defer stop()
 
-		query := &util.PullRequestQuery{
-			Org:     orgName,
-			Repo:    repoName,
-			DevMode: devMode,
-			Client:  util.NewGithubClient(ctx, githubToken()),
-		}
-
-		var earliestDate time.Time
-		if daysBack > 0 {
-			earliestDate = time.Now().AddDate(0, 0, daysBack*-1)
-		}
-
-		reviewerStats := &reviewers.Stats{
-			Query:        query,
-			EarliestDate: earliestDate,
+		var memberTeams *teams.Teams
+		if groupBy == groupByTeam {
+			var err error
+			memberTeams, err = loadTeams(ctx)
+			if err != nil {
+				return err
+			}
 		}
 
-		err := query.IteratePullRequests(ctx, reviewerStats.ProcessOne)
+		failures := newFailures()
+		reviewerStats, partial, err := collectReviewerStats(ctx, cmd.Name(), failures)
 		if err != nil {
-			return errors.Wrap(err, "failed to retrieve pull request details")
+			return err
 		}
+		reportPartial(os.Stdout, partial)
+		reportSample(os.Stdout)
 
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
+		personStats := reviewerStats
+		if memberTeams != nil {
+			reviewerStats = reviewerStats.GroupBy(memberTeams.Of)
 		}
-
-		toIgnore := reviewersToIgnore()
 		orderedReviewers := reviewerStats.ReviewersInOrder()
 
 		for _, reviewer := range orderedReviewers {
 
-			if _, ok := toIgnore[reviewer]; ok {
-				continue
-			}
-
 			count := reviewerStats.ReviewCounts[reviewer]
 			prs := reviewerStats.PRsForReviewer(reviewer)
 
-			fmt.Printf("%d/%d: %s\n", count, len(prs), reviewer)
+			states := reviewers.ReviewStates{}
+			if s := reviewerStats.ReviewStates[reviewer]; s != nil {
+				states = *s
+			}
+			fmt.Printf("%d/%d: %s (%s)\n", count, len(prs), reviewer,
+				describeReviewStates(states, int(count), true))
 
-			sort.Slice(prs, func(i, j int) bool {
+			sort.SliceStable(prs, func(i, j int) bool {
 				return prs[i].ReviewCount > prs[j].ReviewCount
 			})
 			for _, prWithCount := range prs {
 				pr := prWithCount.PR
-				fmt.Printf("\t%3d: %s [%s] %q\n", prWithCount.ReviewCount,
-					*pr.HTMLURL, *pr.User.Login, *pr.Title)
+				fmt.Printf("\t%3d: %s %s [%s] %q (%s)\n", prWithCount.ReviewCount,
+					util.RepoName(pr), *pr.HTMLURL, identities().User(pr.User), *pr.Title,
+					describeReviewStates(prWithCount.States, prWithCount.ReviewCount, false))
 			}
 		}
 
-		return nil
+		if memberTeams != nil {
+			printTeamInteractions(memberTeams, personStats.Interactions())
+		}
+
+		return reportFailures(os.Stdout, failures)
 	},
 }
 
-func reviewersToIgnore() map[string]bool {
-	result := map[string]bool{}
-	for _, i := range ignoredReviewers {
-		result[i] = true
+// printTeamInteractions shows how much each team reviews the pull
+// requests of each team, including their own, busiest first
+func printTeamInteractions(memberTeams *teams.Teams, interactions map[string]map[string]int) {
+	edges := graph.New(memberTeams.RollUp(interactions), 1).Edges
+	sort.SliceStable(edges, func(i, j int) bool {
+		return edges[i].Weight > edges[j].Weight
+	})
+
+	fmt.Printf("\nReviews between teams (reviewing team -> author team):\n")
+	for _, edge := range edges {
+		marker := ""
+		if edge.From != edge.To {
+			marker = " (cross-team)"
+		}
+		fmt.Printf("\t%3d: %s -> %s%s\n", edge.Weight, edge.From, edge.To, marker)
+	}
+}
+
+// collectReviewerStats counts the reviews and comments on the pull
+// requests selected by the global options, leaving out ignored
+// reviewers and bots and keeping track of the pull requests that
+// cannot be processed in failures. The progress is checkpointed
+// under the name of the command, and the stats are partial if the
+// run is interrupted.
+func collectReviewerStats(ctx context.Context, name string, failures *util.Failures) (*reviewers.Stats, bool, error) {
+	ignore, err := peopleToIgnore()
+	if err != nil {
+		return nil, false, err
 	}
-	for _, i := range viper.GetStringSlice(ignoreConfigOptionName) {
-		result[i] = true
+
+	var earliestDate time.Time
+	if daysBack > 0 {
+		earliestDate = time.Now().AddDate(0, 0, daysBack*-1)
+	}
+
+	source, cp, err := newResumableSource(ctx, name, earliestDate)
+	if err != nil {
+		return nil, false, err
+	}
+
+	reviewerStats := &reviewers.Stats{
+		Query:        source,
+		Identities:   identities(),
+		EarliestDate: earliestDate,
+		Ignore:       ignore,
+		Log:          logger,
+	}
+
+	err = failures.Iterate(ctx, source, reviewerStats.ProcessOne)
+	partial := finishCheckpoint(ctx, cp, err)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to retrieve pull request details")
 	}
-	return result
+	return reviewerStats, partial, nil
+}
+
+// describeReviewStates summarizes the reviews in each state and the
+// comments that were not part of a review. Counts of zero are left
+// out unless all is true.
+func describeReviewStates(states reviewers.ReviewStates, total int, all bool) string {
+	comments := total - states.Approved - states.ChangesRequested - states.Commented - states.Dismissed
+	parts := []string{}
+	for _, c := range []struct {
+		name  string
+		count int
+	}{
+		{"approved", states.Approved},
+		{"changes requested", states.ChangesRequested},
+		{"commented", states.Commented},
+		{"dismissed", states.Dismissed},
+		{"comments", comments},
+	} {
+		if all || c.count > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", c.name, c.count))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// peopleToIgnore returns the filter for the people to leave out
+// of the reports, from the --ignore and --include-bots options and
+// the configuration file
+func peopleToIgnore() (*identity.Ignore, error) {
+	entries := append([]string{}, ignoredReviewers...)
+	entries = append(entries, viper.GetStringSlice(ignoreConfigOptionName)...)
+	return identity.NewIgnore(entries, identities(), includeBots)
+}
+
+func addIncludeBotsArgs(theCommand *cobra.Command) {
+	theCommand.Flags().BoolVar(&includeBots, "include-bots", false,
+		"include accounts of bots, which are left out by default")
 }
 
 func init() {
@@ -131,6 +211,10 @@ func init() {
 
 	reviewersCmd.Flags().StringSliceVarP(&ignoredReviewers,
 		"ignore", "i", []string{},
-		"ignore a reviewer (useful for bots), can be repeated")
+		"ignore a reviewer, or reviewers matching a /regular expression/, can be repeated")
 	addHistoryArgs(reviewersCmd)
+	addGroupByArgs(reviewersCmd)
+	addIncludeBotsArgs(reviewersCmd)
+	addResumeArgs(reviewersCmd)
+	addSelectionArgs(reviewersCmd)
 }
@@ -16,24 +16,72 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/google/go-github/v45/github"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
+	"github.com/dhellmann/gh-review-stats/snapshot"
+	"github.com/dhellmann/gh-review-stats/store"
+	"github.com/dhellmann/gh-review-stats/util"
+
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/viper"
 )
 
 const githubTokenConfigOptionName = "github.token"
+const githubBaseURLConfigOptionName = "github.base-url"
+const githubUploadURLConfigOptionName = "github.upload-url"
+const githubCABundleConfigOptionName = "github.ca-bundle"
+const githubAppIDConfigOptionName = "github.app.id"
+const githubAppInstallationIDConfigOptionName = "github.app.installation-id"
+const githubAppPrivateKeyFileConfigOptionName = "github.app.private-key-file"
 
 var cfgFile string
 
-// devMode is a flag telling us whether we are in developer mode
-var devMode bool
+// verbose is a flag telling us to report more details about what we are doing
+var verbose bool
+
+// quiet is a flag telling us not to show the progress
+var quiet bool
+
+// progress shows how far the commands have got, shared by all of
+// the clients and queries so the counts cover the whole run
+var progress *util.Progress
+
+// orgName is the GitHub organization to query
+var orgName string
+
+// repoNames are the names or glob patterns of the repositories to
+// query, and repoTopics and excludeTopics filter the repositories
+// by their topics
+var repoNames, repoTopics, excludeTopics []string
+
+// cacheDir is the directory holding cached API responses, and
+// noCache disables the cache entirely
+var cacheDir string
+var noCache bool
+
+// apiName selects the GitHub API used to fetch pull request details
+var apiName string
+
+// useSearch is a flag telling us to find pull requests with the search API
+var useSearch bool
 
-// orgName and repoName are the GitHub organization and repository to query
-var orgName, repoName string
+// concurrency is the number of pull requests to process at the same time
+var concurrency int
+
+// snapshotFile is a snapshot to read pull requests from instead of GitHub
+var snapshotFile string
+
+// dbFile is a database to read pull requests from instead of GitHub
+var dbFile string
 
 // daysBack is the number of days of history to examine (older items are ignored)
 var daysBack int
@@ -50,32 +98,302 @@ func Execute() {
 	cobra.CheckErr(rootCmd.Execute())
 }
 
-func githubToken() string {
-	return viper.GetString(githubTokenConfigOptionName)
+// haveGithubCredentials reports whether a token or GitHub App has
+// been configured
+func haveGithubCredentials() bool {
+	return githubToken() != "" || viper.GetInt64(githubAppIDConfigOptionName) != 0
+}
+
+// githubApp returns the GitHub App credentials from the
+// configuration, or nil if no app is configured
+func githubApp() (*util.AppCredentials, error) {
+	appID := viper.GetInt64(githubAppIDConfigOptionName)
+	if appID == 0 {
+		return nil, nil
+	}
+	installationID := viper.GetInt64(githubAppInstallationIDConfigOptionName)
+	if installationID == 0 {
+		return nil, fmt.Errorf("missing %s for GitHub App %d",
+			githubAppInstallationIDConfigOptionName, appID)
+	}
+	keyFile, err := homedir.Expand(viper.GetString(githubAppPrivateKeyFileConfigOptionName))
+	if err != nil {
+		return nil, err
+	}
+	if keyFile == "" {
+		return nil, fmt.Errorf("missing %s for GitHub App %d",
+			githubAppPrivateKeyFileConfigOptionName, appID)
+	}
+	key, err := os.ReadFile(keyFile) // #nosec G304
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read GitHub App private key")
+	}
+	return &util.AppCredentials{
+		AppID:          appID,
+		InstallationID: installationID,
+		PrivateKey:     key,
+	}, nil
+}
+
+// newGithubClient creates a GitHub API client using the global
+// options
+func newGithubClient(ctx context.Context) (*github.Client, error) {
+	app, err := githubApp()
+	if err != nil {
+		return nil, err
+	}
+	if app != nil && verbose {
+		logger.Info("authenticating as a GitHub App installation",
+			"app", app.AppID, "installation", app.InstallationID)
+	}
+	opts := util.ClientOptions{
+		App:       app,
+		Token:     githubToken(),
+		BaseURL:   viper.GetString(githubBaseURLConfigOptionName),
+		UploadURL: viper.GetString(githubUploadURLConfigOptionName),
+		CABundle:  viper.GetString(githubCABundleConfigOptionName),
+		Progress:  progress,
+		Log:       logger,
+	}
+	if !noCache {
+		opts.CacheDir = cacheDir
+	}
+	return util.NewGithubClient(ctx, opts)
+}
+
+// newPullRequestQuery creates a query for the pull requests in the
+// repositories given by the global options
+func newPullRequestQuery(ctx context.Context) (*util.PullRequestQuery, error) {
+	query, err := newUnlistedPullRequestQuery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query.Repos, err = selectRepositories(ctx, query.Client)
+	if err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// selectRepositories returns the repositories given by the global
+// options, listing the ones in the org when they are chosen by
+// pattern or topic
+func selectRepositories(ctx context.Context, client *github.Client) ([]string, error) {
+	repos, err := util.ListRepositories(ctx, client, orgName, util.RepositoryFilter{
+		Patterns:      repoNames,
+		Topics:        repoTopics,
+		ExcludeTopics: excludeTopics,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(repos) == 0 {
+		return nil, fmt.Errorf("no repositories in %s match the --repo and --topic options", orgName)
+	}
+	if len(repos) > 1 {
+		logger.Info("including repositories", "count", len(repos),
+			"repos", strings.Join(repos, ","))
+	}
+	return repos, nil
+}
+
+// selectSavedRepositories returns the repositories of the pull
+// requests saved in a snapshot or database that match the --repo
+// options, or nil if all of them are included. The topics of the
+// repositories are not saved, so they cannot be used to choose them.
+func selectSavedRepositories(saved []string) ([]string, error) {
+	if len(repoTopics) > 0 || len(excludeTopics) > 0 {
+		return nil, errors.New("--topic and --exclude-topic cannot be used with --from-snapshot or --from-db")
+	}
+	if len(repoNames) == 0 {
+		return nil, nil
+	}
+	filter := util.RepositoryFilter{Patterns: repoNames}
+	repos := filter.MatchNames(saved)
+	if len(repos) == 0 {
+		return nil, fmt.Errorf("no saved repositories match the --repo options, expected one of %s",
+			strings.Join(saved, ", "))
+	}
+	if len(repos) > 1 {
+		logger.Info("including repositories", "count", len(repos),
+			"repos", strings.Join(repos, ","))
+	}
+	return repos, nil
+}
+
+// newUnlistedPullRequestQuery creates a query using the global
+// options without choosing its repositories, for looking up pull
+// requests by repository and number
+func newUnlistedPullRequestQuery(ctx context.Context) (*util.PullRequestQuery, error) {
+	if apiName != "rest" && apiName != "graphql" {
+		return nil, fmt.Errorf("unknown --api %q, expected \"rest\" or \"graphql\"", apiName)
+	}
+	if useSearch && apiName == "graphql" {
+		// The GraphQL listing would be used for the closed pull
+		// requests, ignoring --search.
+		return nil, errors.New("--search cannot be combined with --api graphql")
+	}
+	client, err := newGithubClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	selection, err := pullRequestSelection()
+	if err != nil {
+		return nil, err
+	}
+	return &util.PullRequestQuery{
+		Org:         orgName,
+		Client:      client,
+		Progress:    progress,
+		Log:         logger,
+		Selection:   selection,
+		GraphQL:     apiName == "graphql",
+		Concurrency: concurrency,
+		Search:      useSearch,
+	}, nil
+}
+
+// checkSourceOptions reports an error if the options needed to read
+// pull requests from GitHub are missing
+func checkSourceOptions() error {
+	if snapshotFile != "" || dbFile != "" {
+		return nil
+	}
+	if orgName == "" {
+		return errors.New("Missing required option --org")
+	}
+	if !haveGithubCredentials() {
+		return errors.New("Missing GitHub token")
+	}
+	return nil
+}
+
+// newPullRequestSource returns the source of the pull requests for a
+// report, either a snapshot, a database, or a query of the
+// repositories given by the global options for the pull requests
+// updated since the date
+func newPullRequestSource(ctx context.Context, since time.Time) (util.PullRequestSource, error) {
+	selection, err := pullRequestSelection()
+	if err != nil {
+		return nil, err
+	}
+	if dbFile != "" {
+		db, err := store.OpenReadOnly(dbFile)
+		if err != nil {
+			return nil, err
+		}
+		db.Selection = selection
+		db.Repos, err = selectSavedRepositories(db.Repositories())
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+	if snapshotFile != "" {
+		snap, err := snapshot.Load(snapshotFile)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("reading pull requests from a snapshot", "path", snapshotFile,
+			"count", len(snap.PullRequests), "org", snap.Org, "repos", strings.Join(snap.Repos, ","),
+			"saved", snap.CreatedAt)
+		if snap.Partial {
+			logger.Warn("the snapshot is partial, its export was interrupted")
+		}
+		if snap.Sample != "" {
+			logger.Warn("the snapshot only holds a sample", "sample", snap.Sample)
+		}
+		if !since.IsZero() && snap.Since.After(since) {
+			logger.Warn("the snapshot only includes closed pull requests updated since a later date",
+				"since", snap.Since.Format("2006-01-02"))
+		}
+		source := snap.Source()
+		source.Selection = selection
+		source.Repos, err = selectSavedRepositories(source.Repositories())
+		if err != nil {
+			return nil, err
+		}
+		return source, nil
+	}
+
+	query, err := newPullRequestQuery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query.Since = since
+	return query, nil
+}
+
+// defaultCacheDir returns the location of the response cache when
+// the user does not give one
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gh-review-stats")
 }
 
 func addHistoryArgs(theCommand *cobra.Command) {
 	theCommand.PersistentFlags().StringVarP(&orgName, "org", "o", "",
 		"github org")
-	theCommand.PersistentFlags().StringVarP(&repoName, "repo", "r", "",
-		"github repository")
+	theCommand.PersistentFlags().StringSliceVarP(&repoNames, "repo", "r", []string{},
+		"github repository or glob pattern, can be repeated (defaults to all repositories in the org)")
+	theCommand.PersistentFlags().StringSliceVar(&repoTopics, "topic", []string{},
+		"only include repositories with the topic, can be repeated")
+	theCommand.PersistentFlags().StringSliceVar(&excludeTopics, "exclude-topic", []string{},
+		"leave out repositories with the topic, can be repeated")
 	theCommand.PersistentFlags().IntVar(&daysBack, "days-back", 90,
 		"how many days back to query")
+	theCommand.PersistentFlags().BoolVar(&failFast, "fail-fast", false,
+		"stop at the first pull request that cannot be processed, instead of skipping it")
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
+	cobra.OnInitialize(initLogging, initConfig)
 
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
 	viper.SetDefault(githubTokenConfigOptionName, "")
+	viper.SetDefault(githubBaseURLConfigOptionName, "")
+	viper.SetDefault(githubUploadURLConfigOptionName, "")
+	viper.SetDefault(githubCABundleConfigOptionName, "")
+	viper.SetDefault(githubAppIDConfigOptionName, 0)
+	viper.SetDefault(githubAppInstallationIDConfigOptionName, 0)
+	viper.SetDefault(githubAppPrivateKeyFileConfigOptionName, "")
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "",
 		"config file (default is $HOME/.gh-review-stats.yml)")
-	rootCmd.PersistentFlags().BoolVar(&devMode, "dev", false,
-		"enable developer mode, shortcutting some queries")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false,
+		"report more details")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false,
+		"do not show the progress")
+	rootCmd.PersistentFlags().StringVar(&tokenFlag, "token", "",
+		"GitHub access token (overrides the environment and config file)")
+	rootCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", defaultCacheDir(),
+		"directory for cached API responses")
+	rootCmd.PersistentFlags().BoolVar(&noCache, "no-cache", false,
+		"do not use the API response cache")
+	rootCmd.PersistentFlags().StringVar(&apiName, "api", "rest",
+		"GitHub API to fetch pull request details with, \"rest\" or \"graphql\"")
+	rootCmd.PersistentFlags().IntVar(&concurrency, "concurrency", 1,
+		"number of pull requests to process at the same time")
+	rootCmd.PersistentFlags().BoolVar(&useSearch, "search", false,
+		"use the search API to find closed pull requests updated recently")
+	rootCmd.PersistentFlags().StringVar(&snapshotFile, "from-snapshot", "",
+		"read pull requests from a file created by the export command instead of GitHub")
+	rootCmd.PersistentFlags().StringVar(&dbFile, "from-db", "",
+		"read pull requests from a database created by the sync command instead of GitHub")
+	rootCmd.PersistentFlags().String("github-url", "",
+		"base URL of a GitHub Enterprise Server API")
+	rootCmd.PersistentFlags().String("ca-bundle", "",
+		"file with additional CA certificates to trust")
+	cobra.CheckErr(viper.BindPFlag(githubBaseURLConfigOptionName,
+		rootCmd.PersistentFlags().Lookup("github-url")))
+	cobra.CheckErr(viper.BindPFlag(githubCABundleConfigOptionName,
+		rootCmd.PersistentFlags().Lookup("ca-bundle")))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -94,10 +412,14 @@ func initConfig() {
 		viper.SetConfigType("yml")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	// read in environment variables that match, so
+	// GH_REVIEW_STATS_GITHUB_TOKEN sets github.token
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	viper.AutomaticEnv()
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+		logger.Info("using config file", "path", viper.ConfigFileUsed())
 	}
 }
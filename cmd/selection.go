@@ -0,0 +1,105 @@
+/*
+Copyright © 2022 Doug Hellmann <doug@doughellmann.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/dhellmann/gh-review-stats/util"
+)
+
+// limit is the most pull requests to process
+var limit int
+
+// prRange is the range of pull request numbers to process
+var prRange string
+
+// sampleSize, sampleMethod, and sampleSeed describe the sample of
+// the pull requests to process instead of all of them
+var sampleSize string
+var sampleMethod string
+var sampleSeed int64
+
+// selection is built from the selection options the first time it
+// is needed, so the sources and the reports share it
+var selection *util.Selection
+
+// pullRequestSelection returns the selection of pull requests given
+// by the options, or nil if all of them should be processed
+func pullRequestSelection() (*util.Selection, error) {
+	if selection != nil || (limit == 0 && prRange == "" && sampleSize == "") {
+		return selection, nil
+	}
+	if limit < 0 {
+		return nil, fmt.Errorf("invalid --limit %d, expected a positive number", limit)
+	}
+	if limit > 0 && sampleSize != "" {
+		return nil, errors.New("--limit cannot be combined with --sample")
+	}
+
+	s := &util.Selection{Limit: limit}
+	if prRange != "" {
+		r, err := util.ParseNumberRange(prRange)
+		if err != nil {
+			return nil, err
+		}
+		s.Range = r
+	}
+	if sampleSize != "" {
+		seed := sampleSeed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		sample, err := util.ParseSample(sampleSize, sampleMethod, seed)
+		if err != nil {
+			return nil, err
+		}
+		s.Sample = sample
+	}
+	selection = s
+	return selection, nil
+}
+
+// reportSample notes when a report is based on a sample
+func reportSample(report io.Writer) {
+	if selection == nil || selection.Sample == nil || selection.Sample.Population == 0 {
+		return
+	}
+	fmt.Fprintf(report, "SAMPLE REPORT: based on a %s\n\n", selection.Sample)
+}
+
+// isSample reports whether the pull requests are a sample
+func isSample() bool {
+	return selection != nil && selection.Sample != nil
+}
+
+func addSelectionArgs(theCommand *cobra.Command) {
+	theCommand.Flags().IntVar(&limit, "limit", 0,
+		"process at most this many pull requests")
+	theCommand.Flags().StringVar(&prRange, "pr-range", "",
+		"only process the pull requests numbered within the range, given as first-last")
+	theCommand.Flags().StringVar(&sampleSize, "sample", "",
+		"process a sample of the pull requests, given as a number or a percentage")
+	theCommand.Flags().StringVar(&sampleMethod, "sample-method", util.SampleRandom,
+		fmt.Sprintf("how to draw the sample, %q or %q by repository and month", util.SampleRandom, util.SampleStratified))
+	theCommand.Flags().Int64Var(&sampleSeed, "sample-seed", 0,
+		"seed for drawing the same sample again (defaults to a random seed, shown in the report)")
+}
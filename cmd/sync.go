@@ -0,0 +1,152 @@
+/*
+Copyright © 2022 Doug Hellmann <doug@doughellmann.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/dhellmann/gh-review-stats/store"
+	"github.com/dhellmann/gh-review-stats/util"
+)
+
+// watermarkMargin is subtracted from the time a sync starts to
+// allow for differences between the local clock and GitHub's
+const watermarkMargin = 5 * time.Minute
+
+func init() {
+	var dbFileName string
+
+	var syncCmd = &cobra.Command{
+		Use:   "sync",
+		Short: "Save pull requests and their details to a local database",
+		Long: `Fetch pull requests with their reviews, comments, and commits and
+save them to a SQLite database.
+
+The first sync of a repository fetches the pull requests selected by
+--days-back. Later runs only fetch the pull requests updated since the
+previous sync finished. The database can be given to the other
+commands with --from-db to produce reports without using the GitHub
+API.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if snapshotFile != "" || dbFile != "" {
+				return errors.New("sync reads from GitHub and cannot be combined with --from-snapshot or --from-db")
+			}
+			cobra.CheckErr(checkSourceOptions())
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+
+			db, err := store.Open(dbFileName)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			if err := db.SetOrg(orgName); err != nil {
+				return err
+			}
+
+			query, err := newPullRequestQuery(ctx)
+			if err != nil {
+				return err
+			}
+
+			failures := newFailures()
+			for _, repo := range query.Repos {
+				watermark, err := db.Watermark(repo)
+				if err != nil {
+					return errors.Wrap(err, fmt.Sprintf("could not read the last sync time of %s", repo))
+				}
+				since := watermark
+				if since.IsZero() && daysBack > 0 {
+					since = time.Now().AddDate(0, 0, daysBack*-1)
+				}
+				started := time.Now()
+
+				query.Repos = []string{repo}
+				query.Since = since
+
+				var saved, unchanged int32
+				repoFailures := newFailures()
+				err = repoFailures.Iterate(ctx, query, func(ctx context.Context, pr *github.PullRequest) error {
+					return syncPullRequest(ctx, db, query, pr, &saved, &unchanged)
+				})
+				if err != nil {
+					return errors.Wrap(err, fmt.Sprintf("failed to sync %s", repo))
+				}
+
+				select {
+				case <-ctx.Done():
+					return nil
+				default:
+				}
+
+				logger.Info("synced repository", "repo", repo, "saved", saved, "unchanged", unchanged)
+				failures.Merge(repoFailures)
+				if failed := len(repoFailures.Failed()); failed > 0 {
+					// Leave the watermark alone so the pull requests that
+					// failed are tried again next time.
+					logger.Warn("pull requests could not be saved, not updating the last sync time",
+						"repo", repo, "count", failed)
+					continue
+				}
+				if err := db.SetWatermark(repo, started.Add(-watermarkMargin)); err != nil {
+					return errors.Wrap(err, fmt.Sprintf("could not save the sync time of %s", repo))
+				}
+			}
+
+			return reportFailures(os.Stderr, failures)
+		},
+	}
+
+	addHistoryArgs(syncCmd)
+	syncCmd.Flags().StringVar(&dbFileName, "db", "gh-review-stats.db",
+		"database file to update")
+
+	rootCmd.AddCommand(syncCmd)
+}
+
+// syncPullRequest saves a pull request and its details, unless the
+// saved copy is already up to date
+func syncPullRequest(ctx context.Context, db *store.Store, source util.PullRequestSource, pr *github.PullRequest, saved, unchanged *int32) error {
+	key := util.KeyFor(pr)
+	updatedAt, found, err := db.UpdatedAt(key)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("could not read %s from the database", key))
+	}
+	if found && pr.UpdatedAt != nil && !pr.UpdatedAt.After(updatedAt) {
+		atomic.AddInt32(unchanged, 1)
+		return nil
+	}
+
+	fetched, err := util.Fetch(ctx, source, pr)
+	if err != nil {
+		return err
+	}
+	if err := db.Save(ctx, fetched); err != nil {
+		return err
+	}
+	atomic.AddInt32(saved, 1)
+	return nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright © 2022 Doug Hellmann <doug@doughellmann.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/dhellmann/gh-review-stats/teams"
+	"github.com/dhellmann/gh-review-stats/util"
+)
+
+const teamsConfigOptionName = "teams"
+
+// groupByTeam is the value of --group-by for rolling up the stats
+// of the members of each team
+const groupByTeam = "team"
+
+// groupBy is how to combine the stats of individual people, empty
+// to report on each person
+var groupBy string
+
+// useGithubTeams tells us to include all of the teams in the GitHub
+// organization
+var useGithubTeams bool
+
+// checkGroupByOptions returns an error if the --group-by option is
+// not understood
+func checkGroupByOptions() error {
+	if groupBy != "" && groupBy != groupByTeam {
+		return fmt.Errorf("unknown --group-by value %q, expected %q", groupBy, groupByTeam)
+	}
+	return nil
+}
+
+// loadTeams returns the teams from the configuration file, with the
+// members of any teams linked to GitHub teams looked up in the
+// organization, plus all of the teams in the organization if
+// --github-teams is set
+func loadTeams(ctx context.Context) (*teams.Teams, error) {
+	configured := []teams.Team{}
+	if err := viper.UnmarshalKey(teamsConfigOptionName, &configured); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("could not read %s", teamsConfigOptionName))
+	}
+
+	needGithub := useGithubTeams
+	for _, team := range configured {
+		if team.GitHubTeam != "" {
+			needGithub = true
+		}
+	}
+	if !needGithub {
+		if len(configured) == 0 {
+			logger.Warn("no teams are configured, everyone is in one team", "team", teams.NoTeam)
+		}
+		return teams.New(configured, identities()), nil
+	}
+
+	if orgName == "" {
+		return nil, errors.New("Missing required option --org to look up GitHub teams")
+	}
+	if !haveGithubCredentials() {
+		return nil, errors.New("Missing GitHub token to look up GitHub teams")
+	}
+	client, err := newGithubClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if useGithubTeams {
+		githubTeams, err := util.ListTeams(ctx, client, orgName)
+		if err != nil {
+			return nil, err
+		}
+		for _, team := range githubTeams {
+			configured = append(configured, teams.Team{
+				Name:       team.GetName(),
+				GitHubTeam: team.GetSlug(),
+			})
+		}
+	}
+
+	// Members listed in the configuration file are added to the
+	// members of the GitHub team.
+	for i, team := range configured {
+		if team.GitHubTeam == "" {
+			continue
+		}
+		members, err := util.ListTeamMembers(ctx, client, orgName, team.GitHubTeam)
+		if err != nil {
+			return nil, err
+		}
+		configured[i].Members = append(configured[i].Members, members...)
+	}
+
+	return teams.New(configured, identities()), nil
+}
+
+func addGroupByArgs(theCommand *cobra.Command) {
+	theCommand.Flags().StringVar(&groupBy, "group-by", "",
+		fmt.Sprintf("combine the stats of people, the only choice is %q", groupByTeam))
+	theCommand.Flags().BoolVar(&useGithubTeams, "github-teams", false,
+		"include all of the teams in the GitHub org when grouping by team")
+}
+
+func init() {
+	viper.SetDefault(teamsConfigOptionName, []interface{}{})
+}
@@ -0,0 +1,98 @@
+/*
+Copyright © 2022 Doug Hellmann <doug@doughellmann.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/dhellmann/gh-review-stats/util"
+	"github.com/spf13/viper"
+)
+
+// envPrefix is added to the name of environment variables that
+// override configuration settings
+const envPrefix = "GH_REVIEW_STATS"
+
+// tokenFlag is the token given on the command line
+var tokenFlag string
+
+// resolvedToken and tokenSource cache the result of looking for a
+// token, so the search only happens (and is reported) once
+var resolvedToken, tokenSource string
+var tokenResolved bool
+
+// githubHost returns the name of the GitHub server being used, to
+// look up its credentials
+func githubHost() string {
+	baseURL := viper.GetString(githubBaseURLConfigOptionName)
+	if baseURL == "" {
+		return "github.com"
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return baseURL
+	}
+	return u.Hostname()
+}
+
+// resolveGithubToken looks for a token in each of the supported
+// places, in order of precedence, and returns the first one found
+// along with a description of where it came from.
+func resolveGithubToken() (string, string) {
+	if tokenFlag != "" {
+		return tokenFlag, "the --token option"
+	}
+
+	// Use the same variables as the gh command line tool.
+	envVars := []string{"GH_TOKEN", "GITHUB_TOKEN"}
+	if githubHost() != "github.com" {
+		envVars = []string{"GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"}
+	}
+	envVars = append(envVars, envPrefix+"_GITHUB_TOKEN")
+	for _, name := range envVars {
+		if token := os.Getenv(name); token != "" {
+			return token, fmt.Sprintf("the %s environment variable", name)
+		}
+	}
+
+	token, err := util.GHCLIToken(githubHost())
+	if err != nil {
+		logger.Warn("could not read gh credentials", "err", err)
+	}
+	if token != "" {
+		return token, fmt.Sprintf("the gh credentials for %s", githubHost())
+	}
+
+	if token := viper.GetString(githubTokenConfigOptionName); token != "" {
+		return token, fmt.Sprintf("the %s setting in %s",
+			githubTokenConfigOptionName, viper.ConfigFileUsed())
+	}
+
+	return "", ""
+}
+
+func githubToken() string {
+	if !tokenResolved {
+		resolvedToken, tokenSource = resolveGithubToken()
+		tokenResolved = true
+		if verbose && tokenSource != "" {
+			logger.Info("using GitHub token", "source", tokenSource)
+		}
+	}
+	return resolvedToken
+}
@@ -20,94 +20,205 @@ import (
 	"sort"
 	"time"
 
+	"github.com/dhellmann/gh-review-stats/identity"
 	"github.com/dhellmann/gh-review-stats/stats"
+	"github.com/dhellmann/gh-review-stats/util"
 	"github.com/google/go-github/v45/github"
 )
 
+// Kind describes what happened in an event
+type Kind string
+
+const (
+	Opened               Kind = "opened"
+	StillOpen            Kind = "still_open"
+	Closed               Kind = "closed"
+	Updated              Kind = "updated"
+	Reviewed             Kind = "reviewed"
+	Commented            Kind = "commented"
+	ReviewRequested      Kind = "review_requested"
+	ReviewRequestRemoved Kind = "review_request_removed"
+	ReadyForReview       Kind = "ready_for_review"
+	ConvertedToDraft     Kind = "convert_to_draft"
+	Labeled              Kind = "labeled"
+	Unlabeled            Kind = "unlabeled"
+	ForcePushed          Kind = "head_ref_force_pushed"
+	Assigned             Kind = "assigned"
+	Unassigned           Kind = "unassigned"
+	Reopened             Kind = "reopened"
+)
+
 type Event struct {
 	Date        *time.Time
+	Kind        Kind
 	Description string
 	Person      string
-}
 
-func getName(user *github.User) string {
-	if user.Name != nil {
-		return *user.Name
-	}
-	if user.Login != nil {
-		return *user.Login
-	}
-	return "unnamed"
+	// Bot is true when GitHub tells us the person is a bot
+	Bot bool
 }
 
-func GetOrderedEvents(prd *stats.PullRequestDetails) []*Event {
+// GetOrderedEvents returns the events in the history of a pull
+// request, oldest first, with the people involved named using the
+// identities
+func GetOrderedEvents(prd *stats.PullRequestDetails, identities *identity.Map) []*Event {
+	// prName identifies the pull request, including the repository
+	// because the events of several repositories may be merged.
+	prName := util.KeyFor(prd.Pull).String()
+
 	results := []*Event{
 		{
 			Date: prd.Pull.CreatedAt,
-			Description: fmt.Sprintf("#%d opened by %s %q (%s)",
-				*prd.Pull.Number, getName(prd.Pull.User), *prd.Pull.Title,
+			Kind: Opened,
+			Description: fmt.Sprintf("%s opened by %s %q (%s)",
+				prName, identities.User(prd.Pull.User), *prd.Pull.Title,
 				*prd.Pull.HTMLURL),
-			Person: getName(prd.Pull.User),
+			Person: identities.User(prd.Pull.User),
+			Bot:    util.IsBot(prd.Pull.User),
 		},
 	}
 	if prd.Pull.ClosedAt != nil {
 		daysOpen := int(prd.Pull.ClosedAt.Sub(*prd.Pull.CreatedAt).Hours() / 24)
+		// The timeline tells us who merged or closed the pull
+		// request.
+		closedBy := ""
+		for _, e := range prd.Timeline {
+			if (e.GetEvent() == "merged" || e.GetEvent() == "closed") && e.Actor != nil {
+				closedBy = identities.User(e.Actor)
+			}
+		}
+		state := prd.State
+		if closedBy != "" {
+			state = fmt.Sprintf("%s by %s", state, closedBy)
+		}
 		results = append(results, &Event{
 			Date: prd.Pull.ClosedAt,
-			Description: fmt.Sprintf("#%d %s after %d days %q (%s)",
-				*prd.Pull.Number, prd.State, daysOpen, *prd.Pull.Title,
+			Kind: Closed,
+			Description: fmt.Sprintf("%s %s after %d days %q (%s)",
+				prName, state, daysOpen, *prd.Pull.Title,
 				*prd.Pull.HTMLURL),
+			Person: closedBy,
 		})
 	} else {
 		daysOpen := int(time.Since(*prd.Pull.CreatedAt).Hours() / 24)
 		now := time.Now()
 		results = append(results, &Event{
 			Date: &now,
-			Description: fmt.Sprintf("#%d %s %d days %q (%s)",
-				*prd.Pull.Number, prd.State, daysOpen, *prd.Pull.Title,
+			Kind: StillOpen,
+			Description: fmt.Sprintf("%s %s %d days %q (%s)",
+				prName, prd.State, daysOpen, *prd.Pull.Title,
 				*prd.Pull.HTMLURL),
 		})
 	}
 
 	for _, commit := range prd.Commits {
+		author := identities.CommitAuthor(commit)
 		results = append(results, &Event{
 			Date: commit.Commit.Author.Date,
-			Description: fmt.Sprintf("#%d updated by %s",
-				*prd.Pull.Number, *commit.Commit.Author.Name),
-			Person: *commit.Commit.Author.Name,
+			Kind: Updated,
+			Description: fmt.Sprintf("%s updated by %s",
+				prName, author),
+			Person: author,
+			Bot:    util.IsBot(commit.Author),
 		})
 	}
 
 	for _, review := range prd.Reviews {
 		results = append(results, &Event{
 			Date: review.SubmittedAt,
-			Description: fmt.Sprintf("#%d review by %s", *prd.Pull.Number,
-				getName(review.User)),
-			Person: getName(review.User),
+			Kind: Reviewed,
+			Description: fmt.Sprintf("%s review by %s", prName,
+				identities.User(review.User)),
+			Person: identities.User(review.User),
+			Bot:    util.IsBot(review.User),
 		})
 	}
 
 	for _, comment := range prd.PullRequestComments {
 		results = append(results, &Event{
 			Date: comment.CreatedAt,
-			Description: fmt.Sprintf("#%d comment by %s", *prd.Pull.Number,
-				getName(comment.User)),
-			Person: getName(comment.User),
+			Kind: Commented,
+			Description: fmt.Sprintf("%s comment by %s", prName,
+				identities.User(comment.User)),
+			Person: identities.User(comment.User),
+			Bot:    util.IsBot(comment.User),
 		})
 	}
 
 	for _, comment := range prd.IssueComments {
 		results = append(results, &Event{
 			Date: comment.CreatedAt,
-			Description: fmt.Sprintf("#%d comment by %s", *prd.Pull.Number,
-				getName(comment.User)),
-			Person: getName(comment.User),
+			Kind: Commented,
+			Description: fmt.Sprintf("%s comment by %s", prName,
+				identities.User(comment.User)),
+			Person: identities.User(comment.User),
+			Bot:    util.IsBot(comment.User),
 		})
 	}
 
+	for _, e := range prd.Timeline {
+		if event := timelineEvent(prName, e, identities); event != nil {
+			results = append(results, event)
+		}
+	}
+
 	sort.Slice(results, func(i, j int) bool {
 		return results[i].Date.Before(*results[j].Date)
 	})
 
 	return results
 }
+
+// timelineEvent converts an entry from the timeline of a pull request
+// to an event, or returns nil for the kinds of entries that are
+// reported some other way or not at all
+func timelineEvent(prName string, e *github.Timeline, identities *identity.Map) *Event {
+	if e.CreatedAt == nil || e.Actor == nil {
+		return nil
+	}
+	actor := identities.User(e.Actor)
+	event := &Event{
+		Date:   e.CreatedAt,
+		Kind:   Kind(e.GetEvent()),
+		Person: actor,
+		Bot:    util.IsBot(e.Actor),
+	}
+
+	// Team review requests do not include the reviewer.
+	reviewer := "a team"
+	if e.Reviewer != nil {
+		reviewer = identities.User(e.Reviewer)
+	}
+
+	switch event.Kind {
+	case ReviewRequested:
+		event.Description = fmt.Sprintf("%s review requested from %s by %s",
+			prName, reviewer, actor)
+	case ReviewRequestRemoved:
+		event.Description = fmt.Sprintf("%s review request for %s removed by %s",
+			prName, reviewer, actor)
+	case ReadyForReview:
+		event.Description = fmt.Sprintf("%s marked ready for review by %s", prName, actor)
+	case ConvertedToDraft:
+		event.Description = fmt.Sprintf("%s converted to draft by %s", prName, actor)
+	case Labeled:
+		event.Description = fmt.Sprintf("%s labeled %q by %s",
+			prName, e.GetLabel().GetName(), actor)
+	case Unlabeled:
+		event.Description = fmt.Sprintf("%s label %q removed by %s",
+			prName, e.GetLabel().GetName(), actor)
+	case ForcePushed:
+		event.Description = fmt.Sprintf("%s force pushed by %s", prName, actor)
+	case Assigned:
+		event.Description = fmt.Sprintf("%s assigned to %s by %s",
+			prName, identities.User(e.Assignee), actor)
+	case Unassigned:
+		event.Description = fmt.Sprintf("%s unassigned from %s by %s",
+			prName, identities.User(e.Assignee), actor)
+	case Reopened:
+		event.Description = fmt.Sprintf("%s reopened by %s", prName, actor)
+	default:
+		return nil
+	}
+	return event
+}
@@ -0,0 +1,93 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dhellmann/gh-review-stats/stats"
+)
+
+func TestGetOrderedEventsTimeline(t *testing.T) {
+	at := func(hour int) *time.Time {
+		t := time.Date(2022, 1, 1, hour, 0, 0, 0, time.UTC)
+		return &t
+	}
+	alice := &github.User{Login: github.String("alice")}
+	bob := &github.User{Login: github.String("bob")}
+
+	prd := &stats.PullRequestDetails{
+		Pull: &github.PullRequest{
+			Number:    github.Int(3),
+			Title:     github.String("title"),
+			HTMLURL:   github.String("https://github.com/o/r/pull/3"),
+			User:      alice,
+			CreatedAt: at(1),
+			ClosedAt:  at(6),
+		},
+		State: "merged",
+		Timeline: []*github.Timeline{
+			{Event: github.String("ready_for_review"), Actor: alice, CreatedAt: at(2)},
+			{Event: github.String("review_requested"), Actor: alice, Reviewer: bob, CreatedAt: at(3)},
+			{Event: github.String("labeled"), Actor: bob, Label: &github.Label{Name: github.String("bug")}, CreatedAt: at(4)},
+			{Event: github.String("head_ref_force_pushed"), Actor: alice, CreatedAt: at(5)},
+			{Event: github.String("merged"), Actor: bob, CreatedAt: at(6)},
+			// Unknown kinds of entries are ignored.
+			{Event: github.String("subscribed"), Actor: bob, CreatedAt: at(6)},
+		},
+	}
+
+	results := GetOrderedEvents(prd, nil)
+	descriptions := []string{}
+	kinds := []Kind{}
+	for _, e := range results {
+		descriptions = append(descriptions, e.Description)
+		kinds = append(kinds, e.Kind)
+	}
+	require.Equal(t, []Kind{Opened, ReadyForReview, ReviewRequested, Labeled, ForcePushed, Closed}, kinds)
+	assert.Equal(t, []string{
+		`r#3 opened by alice "title" (https://github.com/o/r/pull/3)`,
+		"r#3 marked ready for review by alice",
+		"r#3 review requested from bob by alice",
+		`r#3 labeled "bug" by bob`,
+		"r#3 force pushed by alice",
+		`r#3 merged by bob after 0 days "title" (https://github.com/o/r/pull/3)`,
+	}, descriptions)
+	assert.Equal(t, "bob", results[5].Person)
+}
+
+func TestGetOrderedEventsBots(t *testing.T) {
+	at := func(hour int) *time.Time {
+		t := time.Date(2022, 1, 1, hour, 0, 0, 0, time.UTC)
+		return &t
+	}
+	alice := &github.User{Login: github.String("alice")}
+	bot := &github.User{Login: github.String("ci"), Type: github.String("Bot")}
+
+	prd := &stats.PullRequestDetails{
+		Pull: &github.PullRequest{
+			Number:    github.Int(3),
+			Title:     github.String("title"),
+			HTMLURL:   github.String("https://github.com/o/r/pull/3"),
+			User:      alice,
+			CreatedAt: at(1),
+		},
+		State: "open",
+		Commits: []*github.RepositoryCommit{
+			{Author: bot, Commit: &github.Commit{Author: &github.CommitAuthor{Date: at(2)}}},
+		},
+		IssueComments: []*github.IssueComment{
+			{User: bot, CreatedAt: at(3)},
+		},
+	}
+
+	results := GetOrderedEvents(prd, nil)
+	bots := map[Kind]bool{}
+	for _, e := range results {
+		bots[e.Kind] = bots[e.Kind] || e.Bot
+	}
+	assert.Equal(t, map[Kind]bool{Opened: false, StillOpen: false, Updated: true, Commented: true}, bots)
+}
@@ -0,0 +1,171 @@
+package graph
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Edge connects two people, with a weight showing how many times
+// they interacted
+type Edge struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Weight int    `json:"weight"`
+}
+
+// Graph is a weighted directed graph of interactions between people
+type Graph struct {
+	Nodes []string
+	Edges []Edge
+}
+
+// New builds a graph from weights indexed by the source and then the
+// target of each edge, leaving out edges lighter than minWeight and
+// the nodes that are no longer connected to anything
+func New(weights map[string]map[string]int, minWeight int) *Graph {
+	g := &Graph{Nodes: []string{}, Edges: []Edge{}}
+	nodes := map[string]bool{}
+	for from, targets := range weights {
+		for to, weight := range targets {
+			if weight < minWeight || weight <= 0 {
+				continue
+			}
+			g.Edges = append(g.Edges, Edge{From: from, To: to, Weight: weight})
+			nodes[from] = true
+			nodes[to] = true
+		}
+	}
+	for node := range nodes {
+		g.Nodes = append(g.Nodes, node)
+	}
+	sort.Strings(g.Nodes)
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+	return g
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language, with the
+// weight of each edge as its label and pen width
+func (g *Graph) WriteDOT(w io.Writer) error {
+	b := &strings.Builder{}
+	b.WriteString("digraph reviews {\n")
+	for _, node := range g.Nodes {
+		fmt.Fprintf(b, "  %s;\n", strconv.Quote(node))
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(b, "  %s -> %s [weight=%d, label=\"%d\", penwidth=%d];\n",
+			strconv.Quote(e.From), strconv.Quote(e.To), e.Weight, e.Weight, penWidth(e.Weight))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// penWidth scales the width of an edge with its weight, within
+// limits that keep the drawing readable
+func penWidth(weight int) int {
+	switch {
+	case weight < 1:
+		return 1
+	case weight > 10:
+		return 10
+	}
+	return weight
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID string `xml:"id,attr"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+// WriteGraphML writes the graph in the GraphML format, with the
+// weight of each edge as an attribute
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	doc := graphMLDocument{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "weight", For: "edge", AttrName: "weight", AttrType: "int"},
+		},
+	}
+	doc.Graph.ID = "reviews"
+	doc.Graph.EdgeDefault = "directed"
+	for _, node := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: node})
+	}
+	for _, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: e.From,
+			Target: e.To,
+			Data:   []graphMLData{{Key: "weight", Value: strconv.Itoa(e.Weight)}},
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteJSON writes the graph as JSON with a list of the nodes and the
+// adjacency of each node, mapping the targets of its edges to their
+// weights
+func (g *Graph) WriteJSON(w io.Writer) error {
+	adjacency := map[string]map[string]int{}
+	for _, node := range g.Nodes {
+		adjacency[node] = map[string]int{}
+	}
+	for _, e := range g.Edges {
+		adjacency[e.From][e.To] = e.Weight
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Nodes     []string                  `json:"nodes"`
+		Adjacency map[string]map[string]int `json:"adjacency"`
+	}{g.Nodes, adjacency})
+}
@@ -0,0 +1,69 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGraph() *Graph {
+	return New(map[string]map[string]int{
+		"alice": {"bob": 3, "carol": 1},
+		"bob":   {"alice": 2},
+		"dave":  {"erin": 1},
+	}, 2)
+}
+
+func TestNewThreshold(t *testing.T) {
+	g := newTestGraph()
+	assert.Equal(t, []string{"alice", "bob"}, g.Nodes)
+	assert.Equal(t, []Edge{
+		{From: "alice", To: "bob", Weight: 3},
+		{From: "bob", To: "alice", Weight: 2},
+	}, g.Edges)
+}
+
+func TestWriteDOT(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, newTestGraph().WriteDOT(buf))
+	assert.Equal(t, `digraph reviews {
+  "alice";
+  "bob";
+  "alice" -> "bob" [weight=3, label="3", penwidth=3];
+  "bob" -> "alice" [weight=2, label="2", penwidth=2];
+}
+`, buf.String())
+}
+
+func TestWriteGraphML(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, newTestGraph().WriteGraphML(buf))
+
+	doc := graphMLDocument{}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, "directed", doc.Graph.EdgeDefault)
+	assert.Equal(t, 2, len(doc.Graph.Nodes))
+	require.Equal(t, 2, len(doc.Graph.Edges))
+	assert.Equal(t, "alice", doc.Graph.Edges[0].Source)
+	assert.Equal(t, "3", doc.Graph.Edges[0].Data[0].Value)
+}
+
+func TestWriteJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, newTestGraph().WriteJSON(buf))
+
+	result := struct {
+		Nodes     []string
+		Adjacency map[string]map[string]int
+	}{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &result))
+	assert.Equal(t, []string{"alice", "bob"}, result.Nodes)
+	assert.Equal(t, map[string]map[string]int{
+		"alice": {"bob": 3},
+		"bob":   {"alice": 2},
+	}, result.Adjacency)
+}
@@ -0,0 +1,143 @@
+package identity
+
+import (
+	"strings"
+
+	"github.com/google/go-github/v45/github"
+)
+
+// unnamed is used for users we know nothing about
+const unnamed = "unnamed"
+
+// Person describes the accounts, display names, and email addresses
+// used by one person
+type Person struct {
+	// Name is how the person is shown in reports
+	Name   string   `mapstructure:"name"`
+	Logins []string `mapstructure:"logins"`
+	Names  []string `mapstructure:"names"`
+	Emails []string `mapstructure:"emails"`
+}
+
+// Map resolves the different ways a person appears in GitHub data to
+// one name. A nil Map is valid and uses the GitHub login of each
+// user.
+type Map struct {
+	byLogin map[string]string
+	byName  map[string]string
+	byEmail map[string]string
+}
+
+// New creates a Map for the people
+func New(people []Person) *Map {
+	m := &Map{
+		byLogin: map[string]string{},
+		byName:  map[string]string{},
+		byEmail: map[string]string{},
+	}
+	for _, p := range people {
+		name := p.Name
+		if name == "" && len(p.Logins) > 0 {
+			name = p.Logins[0]
+		}
+		if name == "" {
+			continue
+		}
+		// The canonical name is also an alias, so it can be used in
+		// other settings, such as the ignore list.
+		m.byName[normalize(name)] = name
+		for _, login := range p.Logins {
+			m.byLogin[normalize(login)] = name
+		}
+		for _, n := range p.Names {
+			m.byName[normalize(n)] = name
+		}
+		for _, email := range p.Emails {
+			m.byEmail[normalize(email)] = name
+		}
+	}
+	return m
+}
+
+func normalize(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// lookup returns the canonical name for a value in one of the maps,
+// or an empty string
+func lookup(aliases map[string]string, value string) string {
+	if value == "" || aliases == nil {
+		return ""
+	}
+	return aliases[normalize(value)]
+}
+
+// Canonical returns the name of the person using a login, display
+// name, or email address, or the value itself if it is not known
+func (m *Map) Canonical(value string) string {
+	if m != nil {
+		for _, aliases := range []map[string]string{m.byLogin, m.byName, m.byEmail} {
+			if name := lookup(aliases, value); name != "" {
+				return name
+			}
+		}
+	}
+	return value
+}
+
+// User returns the name of the person with a GitHub account. Users
+// without an alias are shown with their login, because the display
+// name is often missing from API responses.
+func (m *Map) User(user *github.User) string {
+	if user == nil {
+		return unnamed
+	}
+	if m != nil {
+		if name := lookup(m.byLogin, user.GetLogin()); name != "" {
+			return name
+		}
+		if name := lookup(m.byName, user.GetName()); name != "" {
+			return name
+		}
+		if name := lookup(m.byEmail, user.GetEmail()); name != "" {
+			return name
+		}
+	}
+	if user.GetLogin() != "" {
+		return user.GetLogin()
+	}
+	if user.GetName() != "" {
+		return user.GetName()
+	}
+	return unnamed
+}
+
+// CommitAuthor returns the name of the person who wrote a commit.
+// When GitHub has linked the commit to an account, that account is
+// used. Otherwise the name and email in the commit are looked up.
+func (m *Map) CommitAuthor(commit *github.RepositoryCommit) string {
+	if commit.GetAuthor().GetLogin() != "" {
+		return m.User(commit.GetAuthor())
+	}
+	author := commit.GetCommit().GetAuthor()
+	if m != nil {
+		if name := lookup(m.byEmail, author.GetEmail()); name != "" {
+			return name
+		}
+		if name := lookup(m.byName, author.GetName()); name != "" {
+			return name
+		}
+	}
+	if author.GetName() != "" {
+		return author.GetName()
+	}
+	return unnamed
+}
+
+// Same reports whether two users are the same person
+func (m *Map) Same(a, b *github.User) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return m.User(a) == m.User(b)
+}
@@ -0,0 +1,69 @@
+package identity
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNilMap(t *testing.T) {
+	var m *Map
+	assert.Equal(t, "dhellmann", m.User(&github.User{
+		Login: github.String("dhellmann"),
+		Name:  github.String("Doug Hellmann"),
+	}))
+	assert.Equal(t, "Doug Hellmann", m.User(&github.User{Name: github.String("Doug Hellmann")}))
+	assert.Equal(t, "unnamed", m.User(nil))
+	assert.Equal(t, "someone", m.Canonical("someone"))
+}
+
+func TestAliases(t *testing.T) {
+	m := New([]Person{
+		{
+			Name:   "Doug",
+			Logins: []string{"dhellmann", "dhellmann-work"},
+			Names:  []string{"Doug Hellmann"},
+			Emails: []string{"doug@example.com"},
+		},
+	})
+
+	assert.Equal(t, "Doug", m.User(&github.User{Login: github.String("DHellmann-Work")}))
+	assert.Equal(t, "Doug", m.User(&github.User{Name: github.String("doug hellmann")}))
+	assert.Equal(t, "other", m.User(&github.User{Login: github.String("other")}))
+
+	assert.Equal(t, "Doug", m.Canonical("dhellmann"))
+	assert.Equal(t, "Doug", m.Canonical("Doug Hellmann"))
+	assert.Equal(t, "Doug", m.Canonical("doug"))
+
+	assert.True(t, m.Same(
+		&github.User{Login: github.String("dhellmann")},
+		&github.User{Login: github.String("dhellmann-work")},
+	))
+}
+
+func TestCommitAuthor(t *testing.T) {
+	m := New([]Person{
+		{Name: "Doug", Logins: []string{"dhellmann"}, Emails: []string{"doug@example.com"}},
+	})
+
+	commit := func(login, name, email string) *github.RepositoryCommit {
+		c := &github.RepositoryCommit{
+			Commit: &github.Commit{
+				Author: &github.CommitAuthor{Name: github.String(name), Email: github.String(email)},
+			},
+		}
+		if login != "" {
+			c.Author = &github.User{Login: github.String(login)}
+		}
+		return c
+	}
+
+	// Linked to an account by GitHub
+	assert.Equal(t, "Doug", m.CommitAuthor(commit("dhellmann", "Doug Hellmann", "other@example.com")))
+	assert.Equal(t, "someone", m.CommitAuthor(commit("someone", "Some One", "")))
+	// Not linked, but the email is known
+	assert.Equal(t, "Doug", m.CommitAuthor(commit("", "Doug Hellmann", "doug@example.com")))
+	// Not linked or known
+	assert.Equal(t, "Some One", m.CommitAuthor(commit("", "Some One", "one@example.com")))
+}
@@ -0,0 +1,97 @@
+package identity
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/pkg/errors"
+
+	"github.com/dhellmann/gh-review-stats/util"
+)
+
+// botSuffix is added by GitHub to the logins of apps
+const botSuffix = "[bot]"
+
+// Ignore decides which people to leave out of reports: bots, unless
+// they are included on purpose, and the people in the ignore list
+type Ignore struct {
+	identities  *Map
+	names       map[string]bool
+	patterns    []*regexp.Regexp
+	includeBots bool
+}
+
+// NewIgnore creates an Ignore from a list of entries. Entries wrapped
+// in slashes, such as "/^ci-/", are regular expressions matched
+// against the names people have in reports. Other entries may be any
+// alias of a person in the identities.
+func NewIgnore(entries []string, identities *Map, includeBots bool) (*Ignore, error) {
+	i := &Ignore{
+		identities:  identities,
+		names:       map[string]bool{},
+		includeBots: includeBots,
+	}
+	for _, entry := range entries {
+		if len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+			pattern, err := regexp.Compile(entry[1 : len(entry)-1])
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("invalid ignore pattern %s", entry))
+			}
+			i.patterns = append(i.patterns, pattern)
+			continue
+		}
+		i.names[identities.Canonical(entry)] = true
+	}
+	return i, nil
+}
+
+// Name reports whether the person with the name, as shown in
+// reports, should be left out
+func (i *Ignore) Name(name string) bool {
+	if i == nil {
+		return false
+	}
+	if !i.includeBots && strings.HasSuffix(name, botSuffix) {
+		return true
+	}
+	if i.names[name] {
+		return true
+	}
+	for _, pattern := range i.patterns {
+		if pattern.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Account reports whether the person with the name should be left
+// out, given whether we know their account is a bot
+func (i *Ignore) Account(name string, bot bool) bool {
+	if i == nil {
+		return false
+	}
+	if !i.includeBots && bot {
+		return true
+	}
+	return i.Name(name)
+}
+
+// User reports whether the user should be left out
+func (i *Ignore) User(user *github.User) bool {
+	if i == nil {
+		return false
+	}
+	return i.Account(i.identities.User(user), util.IsBot(user))
+}
+
+// CommitAuthor reports whether the author of the commit should be
+// left out
+func (i *Ignore) CommitAuthor(commit *github.RepositoryCommit) bool {
+	if i == nil {
+		return false
+	}
+	return i.Account(i.identities.CommitAuthor(commit), util.IsBot(commit.GetAuthor()))
+}
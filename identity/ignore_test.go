@@ -0,0 +1,49 @@
+package identity
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIgnore(t *testing.T) {
+	m := New([]Person{
+		{Name: "alice", Logins: []string{"alice", "alice-work"}},
+	})
+	app := &github.User{Login: github.String("dependabot[bot]")}
+	typed := &github.User{Login: github.String("ci-runner"), Type: github.String("Bot")}
+	human := &github.User{Login: github.String("bob")}
+	botCommit := &github.RepositoryCommit{
+		Commit: &github.Commit{
+			Author: &github.CommitAuthor{Name: github.String("github-actions[bot]")},
+		},
+	}
+
+	ignore, err := NewIgnore([]string{"alice-work", "/^renovate/"}, m, false)
+	require.NoError(t, err)
+	assert.True(t, ignore.Name("alice"))
+	assert.True(t, ignore.Name("renovate-app"))
+	assert.True(t, ignore.Name("dependabot[bot]"))
+	assert.False(t, ignore.Name("bob"))
+	assert.True(t, ignore.User(app))
+	assert.True(t, ignore.User(typed))
+	assert.False(t, ignore.User(human))
+	assert.True(t, ignore.CommitAuthor(botCommit))
+	assert.True(t, ignore.Account("ci", true))
+	assert.False(t, ignore.Account("ci", false))
+
+	withBots, err := NewIgnore([]string{"alice"}, m, true)
+	require.NoError(t, err)
+	assert.False(t, withBots.User(app))
+	assert.False(t, withBots.User(typed))
+	assert.False(t, withBots.CommitAuthor(botCommit))
+	assert.True(t, withBots.Name("alice"))
+
+	var none *Ignore
+	assert.False(t, none.User(app))
+
+	_, err = NewIgnore([]string{"/(/"}, m, false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,216 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level orders the messages by how important they are
+type Level int
+
+// The levels, from the most to the least detailed
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel returns the level with the name
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q, expected \"debug\", \"info\", \"warn\", or \"error\"", name)
+}
+
+// The formats the messages can be written in
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Logger writes messages at or above a level, along with key and
+// value pairs describing them, as lines of text or JSON objects.
+//
+// A nil Logger writes the messages at LevelInfo and above as text to
+// stderr, so code that is not given a Logger still shows warnings.
+type Logger struct {
+	out    io.Writer
+	level  Level
+	json   bool
+	fields []interface{}
+	now    func() time.Time
+	mu     *sync.Mutex
+}
+
+// fallback is used in place of a nil Logger
+var fallback = &Logger{
+	out:   os.Stderr,
+	level: LevelInfo,
+	now:   time.Now,
+	mu:    &sync.Mutex{},
+}
+
+// New creates a Logger writing the messages at or above the level to
+// out, in the format
+func New(out io.Writer, level Level, format string) (*Logger, error) {
+	if format != FormatText && format != FormatJSON {
+		return nil, fmt.Errorf("unknown log format %q, expected %q or %q", format, FormatText, FormatJSON)
+	}
+	return &Logger{
+		out:   out,
+		level: level,
+		json:  format == FormatJSON,
+		now:   time.Now,
+		mu:    &sync.Mutex{},
+	}, nil
+}
+
+func (l *Logger) orFallback() *Logger {
+	if l == nil {
+		return fallback
+	}
+	return l
+}
+
+// With returns a Logger that adds the key and value pairs to each
+// message
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	l = l.orFallback()
+	child := *l
+	child.fields = append(append([]interface{}{}, l.fields...), keysAndValues...)
+	return &child
+}
+
+// Enabled reports whether messages at the level are written, so
+// callers can skip preparing details nobody will see
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.orFallback().level
+}
+
+// Debug writes a message with details for tracking down problems
+func (l *Logger) Debug(msg string, keysAndValues ...interface{}) {
+	l.orFallback().write(LevelDebug, msg, keysAndValues)
+}
+
+// Info writes a message about the normal progress of a command
+func (l *Logger) Info(msg string, keysAndValues ...interface{}) {
+	l.orFallback().write(LevelInfo, msg, keysAndValues)
+}
+
+// Warn writes a message about something that may make the results
+// wrong or incomplete
+func (l *Logger) Warn(msg string, keysAndValues ...interface{}) {
+	l.orFallback().write(LevelWarn, msg, keysAndValues)
+}
+
+// Error writes a message about something that failed
+func (l *Logger) Error(msg string, keysAndValues ...interface{}) {
+	l.orFallback().write(LevelError, msg, keysAndValues)
+}
+
+func (l *Logger) write(level Level, msg string, keysAndValues []interface{}) {
+	if level < l.level {
+		return
+	}
+	fields := append(append([]interface{}{}, l.fields...), keysAndValues...)
+	if len(fields)%2 != 0 {
+		fields = append(fields, "(missing)")
+	}
+
+	var line string
+	if l.json {
+		line = l.formatJSON(level, msg, fields)
+	} else {
+		line = l.formatText(level, msg, fields)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintln(l.out, line)
+}
+
+// formatText formats a message as
+//
+//	15:04:05 WARN message key=value key="value with spaces"
+func (l *Logger) formatText(level Level, msg string, fields []interface{}) string {
+	var b strings.Builder
+	b.WriteString(l.now().Format("15:04:05"))
+	b.WriteString(" ")
+	b.WriteString(strings.ToUpper(level.String()))
+	b.WriteString(" ")
+	b.WriteString(msg)
+	for i := 0; i < len(fields); i += 2 {
+		value := fmt.Sprint(plain(fields[i+1]))
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(&b, " %s=%s", fields[i], value)
+	}
+	return b.String()
+}
+
+// formatJSON formats a message as a JSON object, with the time,
+// level, and message first, followed by the fields in order
+func (l *Logger) formatJSON(level Level, msg string, fields []interface{}) string {
+	var b strings.Builder
+	b.WriteString("{")
+	writePair := func(key string, value interface{}) {
+		if b.Len() > 1 {
+			b.WriteString(",")
+		}
+		encodedKey, _ := json.Marshal(key)
+		encodedValue, err := json.Marshal(value)
+		if err != nil {
+			encodedValue, _ = json.Marshal(fmt.Sprint(value))
+		}
+		b.Write(encodedKey)
+		b.WriteString(":")
+		b.Write(encodedValue)
+	}
+	writePair("time", l.now().UTC().Format(time.RFC3339Nano))
+	writePair("level", level.String())
+	writePair("msg", msg)
+	for i := 0; i < len(fields); i += 2 {
+		writePair(fmt.Sprint(fields[i]), plain(fields[i+1]))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// plain converts the values that do not format well on their own
+func plain(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return value
+}
@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLogger(t *testing.T, out *bytes.Buffer, level Level, format string) *Logger {
+	l, err := New(out, level, format)
+	require.NoError(t, err)
+	l.now = func() time.Time {
+		return time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	}
+	return l
+}
+
+func TestText(t *testing.T) {
+	out := &bytes.Buffer{}
+	l := newTestLogger(t, out, LevelInfo, FormatText)
+
+	l.Debug("hidden")
+	l.With("repo", "r").Warn("could not fetch", "page", 2, "err", errors.New("not found"),
+		"duration", 1500*time.Millisecond, "empty", "")
+	assert.Equal(t,
+		"03:04:05 WARN could not fetch repo=r page=2 err=\"not found\" duration=1.5s empty=\"\"\n",
+		out.String())
+}
+
+func TestJSON(t *testing.T) {
+	out := &bytes.Buffer{}
+	l := newTestLogger(t, out, LevelDebug, FormatJSON)
+
+	l.Debug("api request", "endpoint", "/repos/o/r/pulls", "status", 200, "odd")
+	assert.Equal(t,
+		`{"time":"2022-01-02T03:04:05Z","level":"debug","msg":"api request","endpoint":"/repos/o/r/pulls","status":200,"odd":"(missing)"}`+"\n",
+		out.String())
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("WARN")
+	require.NoError(t, err)
+	assert.Equal(t, LevelWarn, level)
+	assert.True(t, (&Logger{level: LevelWarn}).Enabled(LevelError))
+	assert.False(t, (&Logger{level: LevelWarn}).Enabled(LevelInfo))
+
+	_, err = ParseLevel("loud")
+	assert.Error(t, err)
+	_, err = New(&bytes.Buffer{}, LevelInfo, "xml")
+	assert.Error(t, err)
+}
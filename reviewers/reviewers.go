@@ -4,20 +4,71 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/google/go-github/v45/github"
 	"github.com/pkg/errors"
 
+	"github.com/dhellmann/gh-review-stats/identity"
+	"github.com/dhellmann/gh-review-stats/logging"
 	"github.com/dhellmann/gh-review-stats/util"
 )
 
+// ReviewStates counts the reviews a reviewer submitted in each state
+type ReviewStates struct {
+	Approved         int
+	ChangesRequested int
+	Commented        int
+	Dismissed        int
+}
+
+// add counts a review with the state
+func (r *ReviewStates) add(state string) {
+	switch state {
+	case "APPROVED":
+		r.Approved++
+	case "CHANGES_REQUESTED":
+		r.ChangesRequested++
+	case "COMMENTED":
+		r.Commented++
+	case "DISMISSED":
+		r.Dismissed++
+	}
+}
+
+// plus adds the counts of other to r
+func (r *ReviewStates) plus(other *ReviewStates) {
+	r.Approved += other.Approved
+	r.ChangesRequested += other.ChangesRequested
+	r.Commented += other.Commented
+	r.Dismissed += other.Dismissed
+}
+
 type Stats struct {
-	Query            *util.PullRequestQuery
+	Query            util.PullRequestSource
+	Identities       *identity.Map
 	EarliestDate     time.Time
 	ReviewCounts     map[string]int32
-	allPRs           map[int]*github.PullRequest
-	ReviewCountsByPR map[string]map[int]int
+	allPRs           map[util.PRKey]*github.PullRequest
+	ReviewCountsByPR map[string]map[util.PRKey]int
+
+	// ReviewStates and ReviewStatesByPR break down the reviews
+	// included in the counts by their state
+	ReviewStates     map[string]*ReviewStates
+	ReviewStatesByPR map[string]map[util.PRKey]*ReviewStates
+
+	// Ignore tells us which reviewers to leave out of the counts
+	// and which authors to leave out of the interactions
+	Ignore *identity.Ignore
+
+	// Log records the pull requests left out, at
+	// logging.LevelDebug
+	Log *logging.Logger
+
+	// mu protects the counts when pull requests are processed
+	// concurrently
+	mu sync.Mutex
 }
 
 func (s *Stats) ReviewersInOrder() []string {
@@ -31,6 +82,9 @@ func (s *Stats) ReviewersInOrder() []string {
 		sorted = append(sorted, kv{k, v})
 	}
 	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Value == sorted[j].Value {
+			return sorted[i].Key < sorted[j].Key
+		}
 		return sorted[i].Value > sorted[j].Value
 	})
 
@@ -44,6 +98,7 @@ func (s *Stats) ReviewersInOrder() []string {
 type PRWithCount struct {
 	PR          *github.PullRequest
 	ReviewCount int
+	States      ReviewStates
 }
 
 func (s *Stats) PRsForReviewer(name string) []PRWithCount {
@@ -52,87 +107,189 @@ func (s *Stats) PRsForReviewer(name string) []PRWithCount {
 		return nil
 	}
 	prs := []PRWithCount{}
-	for prNum, count := range prMap {
-		prs = append(prs, PRWithCount{PR: s.allPRs[prNum], ReviewCount: count})
+	for key, count := range prMap {
+		prWithCount := PRWithCount{PR: s.allPRs[key], ReviewCount: count}
+		if states := s.ReviewStatesByPR[name][key]; states != nil {
+			prWithCount.States = *states
+		}
+		prs = append(prs, prWithCount)
 	}
+	sort.Slice(prs, func(i, j int) bool {
+		a, b := util.KeyFor(prs[i].PR), util.KeyFor(prs[j].PR)
+		if a.Repo != b.Repo {
+			return a.Repo < b.Repo
+		}
+		return a.Number > b.Number
+	})
 	return prs
 }
 
-func getName(user *github.User) string {
-	if user.Name != nil {
-		return *user.Name
+// GroupBy returns stats with the counts of the reviewers combined
+// into the groups returned for each reviewer, such as their teams.
+// Reviewers in more than one group are counted in each of them, and
+// reviewers in no groups are left out.
+func (s *Stats) GroupBy(groups func(reviewer string) []string) *Stats {
+	result := &Stats{
+		Query:            s.Query,
+		Identities:       s.Identities,
+		EarliestDate:     s.EarliestDate,
+		Ignore:           s.Ignore,
+		ReviewCounts:     map[string]int32{},
+		allPRs:           s.allPRs,
+		ReviewCountsByPR: map[string]map[util.PRKey]int{},
+		ReviewStates:     map[string]*ReviewStates{},
+		ReviewStatesByPR: map[string]map[util.PRKey]*ReviewStates{},
+	}
+	for reviewer, count := range s.ReviewCounts {
+		for _, group := range groups(reviewer) {
+			result.ReviewCounts[group] += count
+
+			if result.ReviewCountsByPR[group] == nil {
+				result.ReviewCountsByPR[group] = map[util.PRKey]int{}
+			}
+			for key, n := range s.ReviewCountsByPR[reviewer] {
+				result.ReviewCountsByPR[group][key] += n
+			}
+
+			if states := s.ReviewStates[reviewer]; states != nil {
+				if result.ReviewStates[group] == nil {
+					result.ReviewStates[group] = &ReviewStates{}
+				}
+				result.ReviewStates[group].plus(states)
+			}
+			if result.ReviewStatesByPR[group] == nil {
+				result.ReviewStatesByPR[group] = map[util.PRKey]*ReviewStates{}
+			}
+			for key, states := range s.ReviewStatesByPR[reviewer] {
+				if result.ReviewStatesByPR[group][key] == nil {
+					result.ReviewStatesByPR[group][key] = &ReviewStates{}
+				}
+				result.ReviewStatesByPR[group][key].plus(states)
+			}
+		}
 	}
-	if user.Login != nil {
-		return *user.Login
+	return result
+}
+
+// Interactions returns the number of reviews and comments each
+// reviewer made on the pull requests of each author, indexed by
+// reviewer and then author. Comments by authors on their own pull
+// requests and reviews of the pull requests of ignored authors are
+// left out.
+func (s *Stats) Interactions() map[string]map[string]int {
+	result := map[string]map[string]int{}
+	for reviewer, prs := range s.ReviewCountsByPR {
+		for key, count := range prs {
+			author := s.Identities.User(s.allPRs[key].User)
+			if author == reviewer || s.Ignore.User(s.allPRs[key].User) {
+				continue
+			}
+			if result[reviewer] == nil {
+				result[reviewer] = map[string]int{}
+			}
+			result[reviewer][author] += count
+		}
 	}
-	return "unnamed"
+	return result
 }
 
 func (s *Stats) ProcessOne(ctx context.Context, pr *github.PullRequest) error {
 
+	if pr.UpdatedAt.Before(s.EarliestDate) {
+		s.Log.Debug("leaving out pull request updated before the earliest date", "pr", util.KeyFor(pr),
+			"updated", pr.GetUpdatedAt(), "earliest", s.EarliestDate)
+		return util.ErrLeftOut
+	}
+
+	issueComments, err := s.Query.GetIssueComments(ctx, pr)
+	if err != nil {
+		return errors.Wrap(err,
+			fmt.Sprintf("could not fetch issue comments on %s", *pr.HTMLURL))
+	}
+
+	prComments, err := s.Query.GetPRComments(ctx, pr)
+	if err != nil {
+		return errors.Wrap(err,
+			fmt.Sprintf("could not fetch PR comments on %s", *pr.HTMLURL))
+	}
+
+	reviews, err := s.Query.GetReviews(ctx, pr)
+	if err != nil {
+		return errors.Wrap(err,
+			fmt.Sprintf("could not fetch reviews on %s", *pr.HTMLURL))
+	}
+
+	// Pull requests may be processed concurrently, so only update
+	// the counts while holding the lock.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.ReviewCounts == nil {
 		s.ReviewCounts = make(map[string]int32)
 	}
 	if s.ReviewCountsByPR == nil {
-		s.ReviewCountsByPR = make(map[string]map[int]int)
+		s.ReviewCountsByPR = make(map[string]map[util.PRKey]int)
 	}
 	if s.allPRs == nil {
-		s.allPRs = make(map[int]*github.PullRequest)
+		s.allPRs = make(map[util.PRKey]*github.PullRequest)
 	}
-
-	if pr.UpdatedAt.Before(s.EarliestDate) {
-		return nil
+	if s.ReviewStates == nil {
+		s.ReviewStates = make(map[string]*ReviewStates)
+	}
+	if s.ReviewStatesByPR == nil {
+		s.ReviewStatesByPR = make(map[string]map[util.PRKey]*ReviewStates)
 	}
 
-	s.allPRs[*pr.Number] = pr
+	key := util.KeyFor(pr)
+	s.allPRs[key] = pr
 
 	incrementPR := func(name string) {
 		if s.ReviewCountsByPR[name] == nil {
-			s.ReviewCountsByPR[name] = make(map[int]int)
+			s.ReviewCountsByPR[name] = make(map[util.PRKey]int)
 		}
-		s.ReviewCountsByPR[name][*pr.Number]++
+		s.ReviewCountsByPR[name][key]++
 	}
 
-	issueComments, err := s.Query.GetIssueComments(ctx, pr)
-	if err != nil {
-		return errors.Wrap(err,
-			fmt.Sprintf("could not fetch issue comments on %s", *pr.HTMLURL))
+	addState := func(name, state string) {
+		if s.ReviewStates[name] == nil {
+			s.ReviewStates[name] = &ReviewStates{}
+		}
+		s.ReviewStates[name].add(state)
+		if s.ReviewStatesByPR[name] == nil {
+			s.ReviewStatesByPR[name] = make(map[util.PRKey]*ReviewStates)
+		}
+		if s.ReviewStatesByPR[name][key] == nil {
+			s.ReviewStatesByPR[name][key] = &ReviewStates{}
+		}
+		s.ReviewStatesByPR[name][key].add(state)
 	}
+
 	for _, c := range issueComments {
-		if c.CreatedAt.IsZero() || c.CreatedAt.Before(s.EarliestDate) {
+		if c.CreatedAt.IsZero() || c.CreatedAt.Before(s.EarliestDate) || s.Ignore.User(c.User) {
 			continue
 		}
-		name := getName(c.User)
+		name := s.Identities.User(c.User)
 		s.ReviewCounts[name]++
 		incrementPR(name)
 	}
 
-	prComments, err := s.Query.GetPRComments(ctx, pr)
-	if err != nil {
-		return errors.Wrap(err,
-			fmt.Sprintf("could not fetch PR comments on %s", *pr.HTMLURL))
-	}
 	for _, c := range prComments {
-		if c.CreatedAt.IsZero() || c.CreatedAt.Before(s.EarliestDate) {
+		if c.CreatedAt.IsZero() || c.CreatedAt.Before(s.EarliestDate) || s.Ignore.User(c.User) {
 			continue
 		}
-		name := getName(c.User)
+		name := s.Identities.User(c.User)
 		s.ReviewCounts[name]++
 		incrementPR(name)
 	}
 
-	reviews, err := s.Query.GetReviews(ctx, pr)
-	if err != nil {
-		return errors.Wrap(err,
-			fmt.Sprintf("could not fetch reviews on %s", *pr.HTMLURL))
-	}
 	for _, r := range reviews {
-		if r.SubmittedAt == nil || r.SubmittedAt.IsZero() || r.SubmittedAt.Before(s.EarliestDate) {
+		if r.SubmittedAt == nil || r.SubmittedAt.IsZero() || r.SubmittedAt.Before(s.EarliestDate) || s.Ignore.User(r.User) {
 			continue
 		}
-		name := getName(r.User)
+		name := s.Identities.User(r.User)
 		s.ReviewCounts[name]++
 		incrementPR(name)
+		addState(name, r.GetState())
 	}
 
 	return nil
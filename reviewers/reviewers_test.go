@@ -0,0 +1,195 @@
+package reviewers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dhellmann/gh-review-stats/identity"
+	"github.com/dhellmann/gh-review-stats/util"
+)
+
+func newPR(repo string, number int, updated time.Time) *github.PullRequest {
+	return &github.PullRequest{
+		Number:    github.Int(number),
+		HTMLURL:   github.String(fmt.Sprintf("https://github.com/o/%s/pull/%d", repo, number)),
+		UpdatedAt: &updated,
+		Base: &github.PullRequestBranch{
+			Repo: &github.Repository{Name: github.String(repo)},
+		},
+	}
+}
+
+func TestProcessOne(t *testing.T) {
+	earliest := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := earliest.Add(-time.Hour)
+	after := earliest.Add(time.Hour)
+
+	alice := &github.User{Login: github.String("alice")}
+	bob := &github.User{Login: github.String("bob")}
+
+	// The same number in two repositories is counted separately.
+	first := newPR("a", 1, after)
+	second := newPR("b", 1, after)
+	old := newPR("a", 2, before)
+
+	source := &util.MemorySource{
+		PullRequests: []*util.MemoryPullRequest{
+			{
+				Pull: first,
+				IssueComments: []*github.IssueComment{
+					{User: alice, CreatedAt: &after},
+					{User: bob, CreatedAt: &before},
+				},
+				PRComments: []*github.PullRequestComment{
+					{User: alice, CreatedAt: &after},
+				},
+				Reviews: []*github.PullRequestReview{
+					{User: bob, State: github.String("CHANGES_REQUESTED"), SubmittedAt: &after},
+				},
+			},
+			{
+				Pull: second,
+				Reviews: []*github.PullRequestReview{
+					{User: alice, State: github.String("APPROVED"), SubmittedAt: &after},
+				},
+			},
+			{
+				Pull: old,
+				Reviews: []*github.PullRequestReview{
+					{User: alice, SubmittedAt: &before},
+				},
+			},
+		},
+	}
+
+	// Bob's display name is only used through the identity map.
+	s := &Stats{
+		Query:        source,
+		EarliestDate: earliest,
+		Identities: identity.New([]identity.Person{
+			{Name: "Bob", Logins: []string{"bob"}},
+		}),
+	}
+	require.NoError(t, source.IteratePullRequests(context.Background(), s.ProcessOne))
+
+	assert.Equal(t, map[string]int32{"alice": 3, "Bob": 1}, s.ReviewCounts)
+	assert.Equal(t, []string{"alice", "Bob"}, s.ReviewersInOrder())
+
+	prs := s.PRsForReviewer("alice")
+	require.Equal(t, 2, len(prs))
+	assert.Equal(t, first, prs[0].PR)
+	assert.Equal(t, 2, prs[0].ReviewCount)
+	assert.Equal(t, second, prs[1].PR)
+	assert.Equal(t, 1, prs[1].ReviewCount)
+	assert.Equal(t, ReviewStates{}, prs[0].States)
+	assert.Equal(t, ReviewStates{Approved: 1}, prs[1].States)
+	assert.Nil(t, s.PRsForReviewer("carol"))
+
+	assert.Equal(t, &ReviewStates{Approved: 1}, s.ReviewStates["alice"])
+	assert.Equal(t, &ReviewStates{ChangesRequested: 1}, s.ReviewStates["Bob"])
+}
+
+func TestInteractions(t *testing.T) {
+	now := time.Now()
+	alice := &github.User{Login: github.String("alice")}
+	bob := &github.User{Login: github.String("bob")}
+
+	pr := newPR("a", 1, now)
+	pr.User = alice
+	source := &util.MemorySource{
+		PullRequests: []*util.MemoryPullRequest{
+			{
+				Pull: pr,
+				IssueComments: []*github.IssueComment{
+					{User: alice, CreatedAt: &now},
+					{User: bob, CreatedAt: &now},
+				},
+				Reviews: []*github.PullRequestReview{
+					{User: bob, SubmittedAt: &now},
+				},
+			},
+		},
+	}
+
+	s := &Stats{Query: source}
+	require.NoError(t, source.IteratePullRequests(context.Background(), s.ProcessOne))
+	assert.Equal(t, map[string]map[string]int{"bob": {"alice": 2}}, s.Interactions())
+}
+
+func TestIgnore(t *testing.T) {
+	now := time.Now()
+	alice := &github.User{Login: github.String("alice")}
+	bob := &github.User{Login: github.String("bob")}
+	bot := &github.User{Login: github.String("ci"), Type: github.String("Bot")}
+
+	byBot := newPR("a", 1, now)
+	byBot.User = bot
+	byAlice := newPR("a", 2, now)
+	byAlice.User = alice
+	source := &util.MemorySource{
+		PullRequests: []*util.MemoryPullRequest{
+			{
+				Pull: byBot,
+				Reviews: []*github.PullRequestReview{
+					{User: bob, SubmittedAt: &now},
+				},
+			},
+			{
+				Pull: byAlice,
+				IssueComments: []*github.IssueComment{
+					{User: bot, CreatedAt: &now},
+					{User: bob, CreatedAt: &now},
+				},
+			},
+		},
+	}
+
+	ignore, err := identity.NewIgnore(nil, nil, false)
+	require.NoError(t, err)
+	s := &Stats{Query: source, Ignore: ignore}
+	require.NoError(t, source.IteratePullRequests(context.Background(), s.ProcessOne))
+	assert.Equal(t, map[string]int32{"bob": 2}, s.ReviewCounts)
+	assert.Equal(t, map[string]map[string]int{"bob": {"alice": 1}}, s.Interactions())
+}
+
+func TestGroupBy(t *testing.T) {
+	now := time.Now()
+	alice := &github.User{Login: github.String("alice")}
+	bob := &github.User{Login: github.String("bob")}
+	carol := &github.User{Login: github.String("carol")}
+
+	source := &util.MemorySource{
+		PullRequests: []*util.MemoryPullRequest{
+			{
+				Pull: newPR("a", 1, now),
+				Reviews: []*github.PullRequestReview{
+					{User: alice, State: github.String("APPROVED"), SubmittedAt: &now},
+					{User: bob, State: github.String("COMMENTED"), SubmittedAt: &now},
+					{User: carol, State: github.String("APPROVED"), SubmittedAt: &now},
+				},
+			},
+		},
+	}
+	s := &Stats{Query: source}
+	require.NoError(t, source.IteratePullRequests(context.Background(), s.ProcessOne))
+
+	grouped := s.GroupBy(func(reviewer string) []string {
+		return map[string][]string{
+			"alice": {"web"},
+			"bob":   {"web", "api"},
+		}[reviewer]
+	})
+	assert.Equal(t, map[string]int32{"web": 2, "api": 1}, grouped.ReviewCounts)
+	assert.Equal(t, &ReviewStates{Approved: 1, Commented: 1}, grouped.ReviewStates["web"])
+
+	prs := grouped.PRsForReviewer("web")
+	require.Equal(t, 1, len(prs))
+	assert.Equal(t, 2, prs[0].ReviewCount)
+	assert.Equal(t, ReviewStates{Approved: 1, Commented: 1}, prs[0].States)
+}
@@ -0,0 +1,111 @@
+package snapshot
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/dhellmann/gh-review-stats/util"
+)
+
+// FormatVersion is the version of the snapshot format written by
+// this package. It changes when the format changes in a way older
+// versions of the tool cannot read.
+const FormatVersion int = 1
+
+// Snapshot holds the pull requests fetched from GitHub, with all of
+// their details, so reports can be produced again without using the
+// API.
+type Snapshot struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Org       string    `json:"org"`
+	Repos     []string  `json:"repos"`
+
+	// Since is the earliest update date of the closed pull requests
+	// included, or zero if all of them were included.
+	Since time.Time `json:"since"`
+
+	PullRequests []*util.MemoryPullRequest `json:"pull_requests"`
+
+	// Partial is true when the export was interrupted before all
+	// of the pull requests were saved.
+	Partial bool `json:"partial,omitempty"`
+
+	// Sample describes the sample of the pull requests the snapshot
+	// holds, when it does not hold all of them.
+	Sample string `json:"sample,omitempty"`
+}
+
+// New creates an empty snapshot of the repositories
+func New(org string, repos []string, since time.Time) *Snapshot {
+	return &Snapshot{
+		Version:      FormatVersion,
+		CreatedAt:    time.Now().UTC(),
+		Org:          org,
+		Repos:        repos,
+		Since:        since,
+		PullRequests: []*util.MemoryPullRequest{},
+	}
+}
+
+// Source returns a PullRequestSource that reads from the snapshot
+func (s *Snapshot) Source() *util.MemorySource {
+	return &util.MemorySource{PullRequests: s.PullRequests}
+}
+
+// Write saves the snapshot as gzip compressed JSON
+func (s *Snapshot) Write(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	if err := json.NewEncoder(zw).Encode(s); err != nil {
+		return errors.Wrap(err, "could not encode snapshot")
+	}
+	return zw.Close()
+}
+
+// Save writes the snapshot to a file
+func (s *Snapshot) Save(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return errors.Wrap(err, "could not create snapshot file")
+	}
+	if err := s.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Read loads a snapshot written by Write
+func Read(r io.Reader) (*Snapshot, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read snapshot")
+	}
+	defer zr.Close()
+
+	s := &Snapshot{}
+	if err := json.NewDecoder(zr).Decode(s); err != nil {
+		return nil, errors.Wrap(err, "could not decode snapshot")
+	}
+	if s.Version < 1 || s.Version > FormatVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d, expected %d or older",
+			s.Version, FormatVersion)
+	}
+	return s, nil
+}
+
+// Load reads a snapshot from a file
+func Load(filename string) (*Snapshot, error) {
+	f, err := os.Open(filename) // #nosec G304
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open snapshot file")
+	}
+	defer f.Close()
+	return Read(f)
+}
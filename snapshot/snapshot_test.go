@@ -0,0 +1,61 @@
+package snapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dhellmann/gh-review-stats/util"
+)
+
+func TestRoundTrip(t *testing.T) {
+	submitted := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	pr := &github.PullRequest{
+		Number:  github.Int(7),
+		HTMLURL: github.String("https://github.com/o/r/pull/7"),
+	}
+
+	s := New("o", []string{"r"}, time.Time{})
+	s.PullRequests = append(s.PullRequests, &util.MemoryPullRequest{
+		Pull: pr,
+		Reviews: []*github.PullRequestReview{
+			{User: &github.User{Login: github.String("alice")}, SubmittedAt: &submitted},
+		},
+		Merged: true,
+	})
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, s.Write(buf))
+
+	loaded, err := Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "o", loaded.Org)
+	assert.Equal(t, []string{"r"}, loaded.Repos)
+
+	source := loaded.Source()
+	assert.Equal(t, []string{"r"}, source.Repositories())
+	got, err := source.GetPullRequest(context.Background(), "r", 7)
+	require.NoError(t, err)
+	fetched, err := util.Fetch(context.Background(), source, got)
+	require.NoError(t, err)
+	assert.True(t, fetched.Merged)
+	require.Equal(t, 1, len(fetched.Reviews))
+	assert.Equal(t, "alice", fetched.Reviews[0].GetUser().GetLogin())
+	assert.True(t, submitted.Equal(*fetched.Reviews[0].SubmittedAt))
+}
+
+func TestReadNewerVersion(t *testing.T) {
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	zw.Write([]byte(`{"version": 99}`))
+	zw.Close()
+
+	_, err := Read(buf)
+	assert.Error(t, err)
+}
@@ -0,0 +1,146 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+
+	"github.com/dhellmann/gh-review-stats/identity"
+	"github.com/dhellmann/gh-review-stats/util"
+)
+
+// readyForReviewAt returns the time the pull request was ready for
+// review, which is when it was opened unless it started as a draft
+func readyForReviewAt(details *PullRequestDetails) *time.Time {
+	for _, e := range details.Timeline {
+		if e.GetEvent() == "ready_for_review" && e.CreatedAt != nil {
+			return e.CreatedAt
+		}
+	}
+	return details.Pull.CreatedAt
+}
+
+// isResponder reports whether activity by the user counts as a
+// response to the author, leaving out the author and bots
+func isResponder(details *PullRequestDetails, identities *identity.Map, user *github.User) bool {
+	return user != nil && !identities.Same(user, details.Pull.User) && !util.IsBot(user)
+}
+
+// computeResponseTimes sets the durations from when the pull request
+// was ready for review until the first responses to it
+func computeResponseTimes(details *PullRequestDetails, identities *identity.Map) {
+	start := readyForReviewAt(details)
+	if start == nil {
+		return
+	}
+
+	var firstReview, firstApproval, firstComment *time.Time
+	earliest := func(current **time.Time, t *time.Time) {
+		if t != nil && (*current == nil || t.Before(**current)) {
+			*current = t
+		}
+	}
+
+	for _, r := range details.Reviews {
+		if !isResponder(details, identities, r.User) || r.GetState() == "PENDING" {
+			continue
+		}
+		earliest(&firstReview, r.SubmittedAt)
+		if r.GetState() == "APPROVED" {
+			earliest(&firstApproval, r.SubmittedAt)
+		}
+	}
+	for _, c := range details.IssueComments {
+		if isResponder(details, identities, c.User) {
+			earliest(&firstComment, c.CreatedAt)
+		}
+	}
+	for _, c := range details.PullRequestComments {
+		if isResponder(details, identities, c.User) {
+			earliest(&firstComment, c.CreatedAt)
+		}
+	}
+
+	since := func(t *time.Time) *time.Duration {
+		if t == nil {
+			return nil
+		}
+		d := t.Sub(*start)
+		// Responses to a draft count as immediate once the pull
+		// request is ready.
+		if d < 0 {
+			d = 0
+		}
+		return &d
+	}
+	details.TimeToFirstReview = since(firstReview)
+	details.TimeToFirstApproval = since(firstApproval)
+	details.TimeToFirstComment = since(firstComment)
+}
+
+// DurationSummary describes the distribution of a set of durations
+type DurationSummary struct {
+	Count  int
+	Median time.Duration
+	P75    time.Duration
+	P90    time.Duration
+
+	// MedianLow and MedianHigh bound the 95% confidence interval of
+	// the median, for when the durations come from a sample of the
+	// pull requests
+	MedianLow  time.Duration
+	MedianHigh time.Duration
+}
+
+// SummarizeDurations computes the median and upper percentiles of
+// the durations
+func SummarizeDurations(values []time.Duration) DurationSummary {
+	sorted := append([]time.Duration{}, values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	low, high := medianInterval(sorted)
+	return DurationSummary{
+		Count:      len(sorted),
+		Median:     percentile(sorted, 0.5),
+		P75:        percentile(sorted, 0.75),
+		P90:        percentile(sorted, 0.9),
+		MedianLow:  low,
+		MedianHigh: high,
+	}
+}
+
+// medianInterval returns the values bounding the 95% confidence
+// interval of the median. The bounds are the ranks given by the
+// normal approximation of the binomial distribution of the number of
+// values below the median, so nothing is assumed about the
+// distribution of the values themselves.
+func medianInterval(sorted []time.Duration) (time.Duration, time.Duration) {
+	n := len(sorted)
+	if n == 0 {
+		return 0, 0
+	}
+	spread := 1.96 * math.Sqrt(float64(n)) / 2
+	lower := int(math.Floor(float64(n)/2-spread)) - 1
+	upper := int(math.Ceil(float64(n)/2+spread+1)) - 1
+	if lower < 0 {
+		lower = 0
+	}
+	if upper > n-1 {
+		upper = n - 1
+	}
+	return sorted[lower], sorted[upper]
+}
+
+// percentile interpolates between the closest ranks of the sorted
+// values
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	fraction := rank - float64(lower)
+	return sorted[lower] + time.Duration(math.Round(fraction*float64(sorted[upper]-sorted[lower])))
+}
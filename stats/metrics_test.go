@@ -0,0 +1,90 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeResponseTimes(t *testing.T) {
+	at := func(hour int) *time.Time {
+		t := time.Date(2022, 1, 1, hour, 0, 0, 0, time.UTC)
+		return &t
+	}
+	author := &github.User{Login: github.String("author")}
+	reviewer := &github.User{Login: github.String("reviewer")}
+	bot := &github.User{Login: github.String("ci[bot]"), Type: github.String("Bot")}
+
+	details := &PullRequestDetails{
+		Pull: &github.PullRequest{User: author, CreatedAt: at(1)},
+		Timeline: []*github.Timeline{
+			{Event: github.String("ready_for_review"), CreatedAt: at(2)},
+		},
+		IssueComments: []*github.IssueComment{
+			{User: author, CreatedAt: at(3)},
+			{User: bot, CreatedAt: at(3)},
+			{User: reviewer, CreatedAt: at(5)},
+		},
+		PullRequestComments: []*github.PullRequestComment{
+			{User: reviewer, CreatedAt: at(4)},
+		},
+		Reviews: []*github.PullRequestReview{
+			{User: bot, State: github.String("APPROVED"), SubmittedAt: at(3)},
+			{User: reviewer, State: github.String("COMMENTED"), SubmittedAt: at(4)},
+			{User: reviewer, State: github.String("APPROVED"), SubmittedAt: at(7)},
+		},
+	}
+	computeResponseTimes(details, nil)
+
+	require.NotNil(t, details.TimeToFirstReview)
+	assert.Equal(t, 2*time.Hour, *details.TimeToFirstReview)
+	require.NotNil(t, details.TimeToFirstComment)
+	assert.Equal(t, 2*time.Hour, *details.TimeToFirstComment)
+	require.NotNil(t, details.TimeToFirstApproval)
+	assert.Equal(t, 5*time.Hour, *details.TimeToFirstApproval)
+}
+
+func TestComputeResponseTimesNoResponse(t *testing.T) {
+	created := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	author := &github.User{Login: github.String("author")}
+	details := &PullRequestDetails{
+		Pull: &github.PullRequest{User: author, CreatedAt: &created},
+		IssueComments: []*github.IssueComment{
+			{User: author, CreatedAt: &created},
+		},
+	}
+	computeResponseTimes(details, nil)
+	assert.Nil(t, details.TimeToFirstReview)
+	assert.Nil(t, details.TimeToFirstComment)
+	assert.Nil(t, details.TimeToFirstApproval)
+}
+
+func TestSummarizeDurations(t *testing.T) {
+	values := []time.Duration{}
+	for i := 10; i >= 1; i-- {
+		values = append(values, time.Duration(i)*time.Hour)
+	}
+	summary := SummarizeDurations(values)
+	assert.Equal(t, 10, summary.Count)
+	assert.Equal(t, 5*time.Hour+30*time.Minute, summary.Median)
+	assert.Equal(t, 7*time.Hour+45*time.Minute, summary.P75)
+	assert.Equal(t, 9*time.Hour+6*time.Minute, summary.P90)
+
+	assert.Equal(t, time.Hour, summary.MedianLow)
+	assert.Equal(t, 10*time.Hour, summary.MedianHigh)
+
+	assert.Equal(t, DurationSummary{}, SummarizeDurations(nil))
+}
+
+func TestMedianInterval(t *testing.T) {
+	values := []time.Duration{}
+	for i := 1; i <= 100; i++ {
+		values = append(values, time.Duration(i)*time.Minute)
+	}
+	summary := SummarizeDurations(values)
+	assert.Equal(t, 40*time.Minute, summary.MedianLow)
+	assert.Equal(t, 61*time.Minute, summary.MedianHigh)
+}
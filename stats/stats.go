@@ -2,12 +2,14 @@ package stats
 
 import (
 	"context"
-	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/google/go-github/v45/github"
-	"github.com/pkg/errors"
 
+	"github.com/dhellmann/gh-review-stats/identity"
+	"github.com/dhellmann/gh-review-stats/logging"
 	"github.com/dhellmann/gh-review-stats/util"
 )
 
@@ -31,9 +33,21 @@ type PullRequestDetails struct {
 	// Updates show as commits
 	Commits []*github.RepositoryCommit
 
+	// Other events, such as review requests, label changes, and
+	// force pushes, are in the timeline
+	Timeline []*github.Timeline
+
 	RecentActivityCount int
 	AllActivityCount    int
 
+	// The time from when the pull request was ready for review
+	// until the first review, comment, and approval by someone
+	// other than the author or a bot. They are nil if there has
+	// not been a response yet.
+	TimeToFirstReview   *time.Duration
+	TimeToFirstComment  *time.Duration
+	TimeToFirstApproval *time.Duration
+
 	State string
 }
 
@@ -45,6 +59,8 @@ type RuleFilter func(*PullRequestDetails) bool
 // Bucket describes a rule for selecting pull requests to group them
 // into a category
 type Bucket struct {
+	// Name describes the bucket in the log
+	Name string
 	// Rule tells us which pull requests belong in the bucket
 	Rule RuleFilter
 	// Requests is the set of pull requests in the bucket
@@ -58,56 +74,74 @@ type Bucket struct {
 
 // Stats holds the overall stats gathered from the repo
 type Stats struct {
-	Query        *util.PullRequestQuery
+	Query        util.PullRequestSource
+	Identities   *identity.Map
 	EarliestDate time.Time
 	Buckets      []*Bucket
+
+	// Failures keeps track of the pull requests that cannot be
+	// processed, so Populate can skip them and try them again.
+	// When it is nil, the first failure stops Populate.
+	Failures *util.Failures
+
+	// Log records why each pull request is left out or which
+	// buckets it is added to, at logging.LevelDebug
+	Log *logging.Logger
+
+	// mu protects the buckets when pull requests are processed
+	// concurrently
+	mu sync.Mutex
 }
 
 // Populate runs the query and filters requests into the appropriate
 // buckets
 func (s *Stats) Populate(ctx context.Context) error {
-	return s.Query.IteratePullRequests(ctx, s.process)
+	var err error
+	if s.Failures != nil {
+		err = s.Failures.Iterate(ctx, s.Query, s.process)
+	} else {
+		err = s.Query.IteratePullRequests(ctx, s.process)
+	}
+	s.sortBuckets()
+	return err
+}
+
+// sortBuckets puts the requests in each bucket in a predictable
+// order, newest first, no matter what order they were processed in.
+func (s *Stats) sortBuckets() {
+	for _, bucket := range s.Buckets {
+		sort.SliceStable(bucket.Requests, func(i, j int) bool {
+			a, b := bucket.Requests[i].Pull, bucket.Requests[j].Pull
+			if a.CreatedAt != nil && b.CreatedAt != nil && !a.CreatedAt.Equal(*b.CreatedAt) {
+				return a.CreatedAt.After(*b.CreatedAt)
+			}
+			if util.RepoName(a) != util.RepoName(b) {
+				return util.RepoName(a) < util.RepoName(b)
+			}
+			return a.GetNumber() > b.GetNumber()
+		})
+	}
 }
 
 // Process extracts the required information from a single PR
 func (s *Stats) process(ctx context.Context, pr *github.PullRequest) error {
 	// Ignore old closed items
 	if !s.EarliestDate.IsZero() && *pr.State == "closed" && pr.UpdatedAt.Before(s.EarliestDate) {
-		return nil
+		s.Log.Debug("leaving out pull request closed before the earliest date", "pr", util.KeyFor(pr),
+			"updated", pr.GetUpdatedAt(), "earliest", s.EarliestDate)
+		return util.ErrLeftOut
 	}
 	return s.ProcessOne(ctx, pr)
 }
 
 func (s *Stats) ProcessOne(ctx context.Context, pr *github.PullRequest) error {
-	isMerged, err := s.Query.IsMerged(ctx, pr)
+	fetched, err := util.Fetch(ctx, s.Query, pr)
 	if err != nil {
-		return errors.Wrap(err,
-			fmt.Sprintf("could not determine merged status of %s", *pr.HTMLURL))
-	}
-
-	issueComments, err := s.Query.GetIssueComments(ctx, pr)
-	if err != nil {
-		return errors.Wrap(err,
-			fmt.Sprintf("could not fetch issue comments on %s", *pr.HTMLURL))
-	}
-
-	prComments, err := s.Query.GetPRComments(ctx, pr)
-	if err != nil {
-		return errors.Wrap(err,
-			fmt.Sprintf("could not fetch PR comments on %s", *pr.HTMLURL))
-	}
-
-	reviews, err := s.Query.GetReviews(ctx, pr)
-	if err != nil {
-		return errors.Wrap(err,
-			fmt.Sprintf("could not fetch reviews on %s", *pr.HTMLURL))
-	}
-
-	commits, err := s.Query.GetCommits(ctx, pr)
-	if err != nil {
-		return errors.Wrap(err,
-			fmt.Sprintf("could not fetch commits on %s", *pr.HTMLURL))
+		return err
 	}
+	issueComments := fetched.IssueComments
+	prComments := fetched.PRComments
+	reviews := fetched.Reviews
 
 	details := &PullRequestDetails{
 		Pull:                pr,
@@ -115,9 +149,10 @@ func (s *Stats) ProcessOne(ctx context.Context, pr *github.PullRequest) error {
 		IssueComments:       issueComments,
 		PullRequestComments: prComments,
 		Reviews:             reviews,
-		Commits:             commits,
+		Commits:             fetched.Commits,
+		Timeline:            fetched.Timeline,
 	}
-	if isMerged {
+	if fetched.Merged {
 		details.State = "merged"
 	}
 	if !s.EarliestDate.IsZero() {
@@ -139,20 +174,31 @@ func (s *Stats) ProcessOne(ctx context.Context, pr *github.PullRequest) error {
 	}
 	details.RecentActivityCount = details.RecentIssueCommentCount + details.RecentPRCommentCount + details.RecentReviewCount
 	details.AllActivityCount = len(details.IssueComments) + len(details.PullRequestComments) + len(details.Reviews)
+	computeResponseTimes(details, s.Identities)
 	s.add(details)
 	return nil
 }
 
 // add records a given pr in the correct bucket(s)
 func (s *Stats) add(details *PullRequestDetails) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := util.KeyFor(details.Pull)
+	added := false
 	for _, bucket := range s.Buckets {
 		match := bucket.Rule(details)
 		if !match {
 			continue
 		}
+		s.Log.Debug("adding pull request to bucket", "pr", key, "bucket", bucket.Name,
+			"state", details.State)
 		bucket.Requests = append(bucket.Requests, details)
+		added = true
 		if !bucket.Cascade {
 			break
 		}
 	}
+	if !added {
+		s.Log.Debug("leaving out pull request matching no bucket", "pr", key, "state", details.State)
+	}
 }
@@ -1,9 +1,18 @@
 package stats
 
 import (
+	"bytes"
+	"context"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/go-github/v45/github"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dhellmann/gh-review-stats/logging"
+	"github.com/dhellmann/gh-review-stats/util"
 )
 
 func TestAddWithCascade(t *testing.T) {
@@ -78,3 +87,112 @@ func TestAddWithoutMatch(t *testing.T) {
 	assert.Equal(t, 0, len(first.Requests))
 	assert.Equal(t, 0, len(second.Requests))
 }
+
+func TestAddLogsBuckets(t *testing.T) {
+	out := &bytes.Buffer{}
+	log, err := logging.New(out, logging.LevelDebug, logging.FormatText)
+	require.NoError(t, err)
+
+	merged := Bucket{
+		Name: "merged",
+		Rule: func(details *PullRequestDetails) bool {
+			return details.State == "merged"
+		},
+	}
+	s := Stats{
+		Buckets: []*Bucket{&merged},
+		Log:     log,
+	}
+	pr := &github.PullRequest{
+		Number:  github.Int(12),
+		HTMLURL: github.String("https://github.com/org/repo/pull/12"),
+	}
+	s.add(&PullRequestDetails{Pull: pr, State: "merged"})
+	s.add(&PullRequestDetails{Pull: pr, State: "closed"})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "adding pull request to bucket pr=repo#12 bucket=merged state=merged")
+	assert.Contains(t, lines[1], "leaving out pull request matching no bucket pr=repo#12 state=closed")
+}
+
+func TestPopulateOrder(t *testing.T) {
+	older := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+
+	bucket := Bucket{
+		Rule: func(details *PullRequestDetails) bool {
+			return true
+		},
+	}
+	s := Stats{
+		Buckets: []*Bucket{&bucket},
+	}
+	s.add(&PullRequestDetails{Pull: &github.PullRequest{Number: github.Int(1), CreatedAt: &older}})
+	s.add(&PullRequestDetails{Pull: &github.PullRequest{Number: github.Int(2), CreatedAt: &newer}})
+	s.sortBuckets()
+	assert.Equal(t, 2, *bucket.Requests[0].Pull.Number)
+	assert.Equal(t, 1, *bucket.Requests[1].Pull.Number)
+}
+
+func TestProcessOne(t *testing.T) {
+	earliest := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := earliest.Add(-time.Hour)
+	after := earliest.Add(time.Hour)
+
+	pr := &github.PullRequest{
+		Number:  github.Int(1),
+		State:   github.String("closed"),
+		HTMLURL: github.String("https://github.com/o/r/pull/1"),
+	}
+	source := &util.MemorySource{
+		PullRequests: []*util.MemoryPullRequest{
+			{
+				Pull: pr,
+				IssueComments: []*github.IssueComment{
+					{CreatedAt: &before},
+					{CreatedAt: &after},
+				},
+				PRComments: []*github.PullRequestComment{
+					{CreatedAt: &after},
+				},
+				Reviews: []*github.PullRequestReview{
+					{SubmittedAt: &before},
+				},
+				Commits: []*github.RepositoryCommit{{}},
+				Merged:  true,
+			},
+		},
+	}
+
+	bucket := Bucket{
+		Rule: func(details *PullRequestDetails) bool {
+			return true
+		},
+	}
+	s := Stats{
+		Query:        source,
+		EarliestDate: earliest,
+		Buckets:      []*Bucket{&bucket},
+	}
+	require.NoError(t, s.ProcessOne(context.Background(), pr))
+	require.Equal(t, 1, len(bucket.Requests))
+
+	details := bucket.Requests[0]
+	assert.Equal(t, "merged", details.State)
+	assert.Equal(t, 1, len(details.Commits))
+	assert.Equal(t, 1, details.RecentIssueCommentCount)
+	assert.Equal(t, 1, details.RecentPRCommentCount)
+	assert.Equal(t, 0, details.RecentReviewCount)
+	assert.Equal(t, 2, details.RecentActivityCount)
+	assert.Equal(t, 4, details.AllActivityCount)
+}
+
+func TestProcessOneUnknown(t *testing.T) {
+	s := Stats{Query: &util.MemorySource{}}
+	err := s.ProcessOne(context.Background(), &github.PullRequest{
+		Number:  github.Int(1),
+		HTMLURL: github.String("https://github.com/o/r/pull/1"),
+	})
+	assert.Error(t, err)
+}
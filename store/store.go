@@ -0,0 +1,594 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/pkg/errors"
+
+	// Register the pure Go SQLite driver, so the tool can still be
+	// built without cgo.
+	_ "modernc.org/sqlite"
+
+	"github.com/dhellmann/gh-review-stats/util"
+)
+
+// schemaVersion is the version of the database schema created by
+// this package, saved in the user_version pragma
+const schemaVersion int = 2
+
+// schema creates the tables. Each row includes the fields useful for
+// queries as columns, and the full API response as JSON in the data
+// column so the original objects can be restored.
+const schema = `
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS sync_state (
+	repo      TEXT PRIMARY KEY,
+	synced_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS pull_requests (
+	repo       TEXT NOT NULL,
+	number     INTEGER NOT NULL,
+	title      TEXT,
+	state      TEXT,
+	merged     INTEGER NOT NULL,
+	author     TEXT,
+	url        TEXT,
+	created_at TEXT,
+	updated_at TEXT,
+	closed_at  TEXT,
+	data       TEXT NOT NULL,
+	PRIMARY KEY (repo, number)
+);
+
+CREATE TABLE IF NOT EXISTS reviews (
+	repo         TEXT NOT NULL,
+	number       INTEGER NOT NULL,
+	position     INTEGER NOT NULL,
+	id           INTEGER,
+	author       TEXT,
+	state        TEXT,
+	submitted_at TEXT,
+	data         TEXT NOT NULL,
+	PRIMARY KEY (repo, number, position)
+);
+
+CREATE TABLE IF NOT EXISTS issue_comments (
+	repo       TEXT NOT NULL,
+	number     INTEGER NOT NULL,
+	position   INTEGER NOT NULL,
+	id         INTEGER,
+	author     TEXT,
+	created_at TEXT,
+	body       TEXT,
+	data       TEXT NOT NULL,
+	PRIMARY KEY (repo, number, position)
+);
+
+CREATE TABLE IF NOT EXISTS review_comments (
+	repo       TEXT NOT NULL,
+	number     INTEGER NOT NULL,
+	position   INTEGER NOT NULL,
+	id         INTEGER,
+	author     TEXT,
+	path       TEXT,
+	created_at TEXT,
+	body       TEXT,
+	data       TEXT NOT NULL,
+	PRIMARY KEY (repo, number, position)
+);
+
+CREATE TABLE IF NOT EXISTS commits (
+	repo         TEXT NOT NULL,
+	number       INTEGER NOT NULL,
+	position     INTEGER NOT NULL,
+	sha          TEXT,
+	author       TEXT,
+	committed_at TEXT,
+	message      TEXT,
+	data         TEXT NOT NULL,
+	PRIMARY KEY (repo, number, position)
+);
+
+CREATE TABLE IF NOT EXISTS timeline_events (
+	repo       TEXT NOT NULL,
+	number     INTEGER NOT NULL,
+	position   INTEGER NOT NULL,
+	id         INTEGER,
+	event      TEXT,
+	actor      TEXT,
+	created_at TEXT,
+	data       TEXT NOT NULL,
+	PRIMARY KEY (repo, number, position)
+);
+`
+
+// detailTables are the tables holding the details of pull requests,
+// which are replaced whenever a pull request is saved
+var detailTables = []string{"reviews", "issue_comments", "review_comments", "commits", "timeline_events"}
+
+// Store is a SQLite database of pull requests and their details for
+// the repositories of one organization. It is also a
+// util.PullRequestSource, so reports can be produced from it.
+type Store struct {
+	// Selection, when set, limits the pull requests iterated over
+	Selection *util.Selection
+
+	// Repos, when set, limits the pull requests iterated over to
+	// the ones in these repositories
+	Repos []string
+
+	db *sql.DB
+}
+
+var _ util.PullRequestSource = (*Store)(nil)
+
+// Open opens the database in the file, creating it if needed
+func Open(filename string) (*Store, error) {
+	s, err := open(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.migrate(); err != nil {
+		s.Close()
+		return nil, errors.Wrap(err, fmt.Sprintf("could not initialize database %s", filename))
+	}
+	return s, nil
+}
+
+// OpenReadOnly opens an existing database, without allowing any
+// changes to it
+func OpenReadOnly(filename string) (*Store, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return nil, errors.Wrap(err, "could not open database")
+	}
+	s, err := open(filename + "?_pragma=query_only(1)")
+	if err != nil {
+		return nil, err
+	}
+	version, err := s.version()
+	if err == nil && (version < 1 || version > schemaVersion) {
+		err = fmt.Errorf("unsupported database version %d, expected 1 to %d",
+			version, schemaVersion)
+	}
+	if err != nil {
+		s.Close()
+		return nil, errors.Wrap(err, fmt.Sprintf("could not read database %s", filename))
+	}
+	return s, nil
+}
+
+func open(dsn string) (*Store, error) {
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("could not open database %s", dsn))
+	}
+	// SQLite only allows one writer at a time, so using one
+	// connection avoids lock errors when pull requests are saved
+	// concurrently. It also keeps in-memory databases from
+	// disappearing when a connection is closed.
+	db.SetMaxOpenConns(1)
+	return &Store{db: db}, nil
+}
+
+// DB returns the database connection, for running other queries
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) version() (int, error) {
+	var version int
+	err := s.db.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+func (s *Store) migrate() error {
+	version, err := s.version()
+	if err != nil {
+		return err
+	}
+	if version > schemaVersion {
+		return fmt.Errorf("unsupported database version %d, expected %d or older",
+			version, schemaVersion)
+	}
+	if _, err := s.db.Exec(schema); err != nil {
+		return err
+	}
+	if version == 1 {
+		// Version 2 added the timeline. Forget when the pull
+		// requests were updated so the next sync fetches all of
+		// them again.
+		if _, err := s.db.Exec("DELETE FROM sync_state; UPDATE pull_requests SET updated_at = NULL"); err != nil {
+			return err
+		}
+	}
+	_, err = s.db.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion))
+	return err
+}
+
+// Org returns the organization the database holds data for, or an
+// empty string if nothing has been saved yet
+func (s *Store) Org() (string, error) {
+	var org string
+	err := s.db.QueryRow("SELECT value FROM meta WHERE key = 'org'").Scan(&org)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return org, err
+}
+
+// SetOrg records the organization the database holds data for. It is
+// an error to change the organization once it is set.
+func (s *Store) SetOrg(org string) error {
+	existing, err := s.Org()
+	if err != nil {
+		return err
+	}
+	if existing != "" && existing != org {
+		return fmt.Errorf("the database holds pull requests for %s, not %s", existing, org)
+	}
+	_, err = s.db.Exec("INSERT OR REPLACE INTO meta (key, value) VALUES ('org', ?)", org)
+	return err
+}
+
+// Watermark returns the time the repository was last synchronized
+// completely, or zero if it has never been synchronized
+func (s *Store) Watermark(repo string) (time.Time, error) {
+	var value string
+	err := s.db.QueryRow("SELECT synced_at FROM sync_state WHERE repo = ?", repo).Scan(&value)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// SetWatermark records the time the repository was last synchronized
+func (s *Store) SetWatermark(repo string, when time.Time) error {
+	_, err := s.db.Exec("INSERT OR REPLACE INTO sync_state (repo, synced_at) VALUES (?, ?)",
+		repo, formatTime(&when))
+	return err
+}
+
+// UpdatedAt returns the update time of the saved copy of a pull
+// request, and false if it has not been saved
+func (s *Store) UpdatedAt(key util.PRKey) (time.Time, bool, error) {
+	var value sql.NullString
+	err := s.db.QueryRow("SELECT updated_at FROM pull_requests WHERE repo = ? AND number = ?",
+		key.Repo, key.Number).Scan(&value)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil || !value.Valid {
+		return time.Time{}, err == nil, err
+	}
+	when, err := time.Parse(time.RFC3339, value.String)
+	return when, true, err
+}
+
+// Save replaces the saved copy of a pull request and its details
+func (s *Store) Save(ctx context.Context, p *util.MemoryPullRequest) (err error) {
+	key := util.KeyFor(p.Pull)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			err = errors.Wrap(err, fmt.Sprintf("could not save %s", key))
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	for _, table := range append([]string{"pull_requests"}, detailTables...) {
+		_, err = tx.ExecContext(ctx,
+			fmt.Sprintf("DELETE FROM %s WHERE repo = ? AND number = ?", table), // #nosec G201
+			key.Repo, key.Number)
+		if err != nil {
+			return err
+		}
+	}
+
+	pr := p.Pull
+	data, err := json.Marshal(pr)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO pull_requests
+		 (repo, number, title, state, merged, author, url, created_at, updated_at, closed_at, data)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		key.Repo, key.Number, pr.GetTitle(), pr.GetState(), p.Merged,
+		pr.GetUser().GetLogin(), pr.GetHTMLURL(),
+		formatTime(pr.CreatedAt), formatTime(pr.UpdatedAt), formatTime(pr.ClosedAt),
+		string(data))
+	if err != nil {
+		return err
+	}
+
+	for i, r := range p.Reviews {
+		if err = insertDetail(ctx, tx, key, i, r,
+			"reviews (repo, number, position, id, author, state, submitted_at, data)",
+			r.GetID(), r.GetUser().GetLogin(), r.GetState(), formatTime(r.SubmittedAt)); err != nil {
+			return err
+		}
+	}
+	for i, c := range p.IssueComments {
+		if err = insertDetail(ctx, tx, key, i, c,
+			"issue_comments (repo, number, position, id, author, created_at, body, data)",
+			c.GetID(), c.GetUser().GetLogin(), formatTime(c.CreatedAt), c.GetBody()); err != nil {
+			return err
+		}
+	}
+	for i, c := range p.PRComments {
+		if err = insertDetail(ctx, tx, key, i, c,
+			"review_comments (repo, number, position, id, author, path, created_at, body, data)",
+			c.GetID(), c.GetUser().GetLogin(), c.GetPath(), formatTime(c.CreatedAt), c.GetBody()); err != nil {
+			return err
+		}
+	}
+	for i, c := range p.Commits {
+		// GetDate returns a zero time for missing dates, which are
+		// saved as NULL.
+		committed := c.GetCommit().GetCommitter().GetDate()
+		if err = insertDetail(ctx, tx, key, i, c,
+			"commits (repo, number, position, sha, author, committed_at, message, data)",
+			c.GetSHA(), c.GetAuthor().GetLogin(),
+			formatTime(&committed), c.GetCommit().GetMessage()); err != nil {
+			return err
+		}
+	}
+	for i, e := range p.Timeline {
+		if err = insertDetail(ctx, tx, key, i, e,
+			"timeline_events (repo, number, position, id, event, actor, created_at, data)",
+			e.GetID(), e.GetEvent(), e.GetActor().GetLogin(), formatTime(e.CreatedAt)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Import saves all of the pull requests from another source
+func (s *Store) Import(ctx context.Context, source util.PullRequestSource) error {
+	return source.IteratePullRequests(ctx, func(ctx context.Context, pr *github.PullRequest) error {
+		fetched, err := util.Fetch(ctx, source, pr)
+		if err != nil {
+			return err
+		}
+		return s.Save(ctx, fetched)
+	})
+}
+
+// insertDetail adds one row to a detail table. The columns must
+// start with repo, number, and position and end with data, with the
+// values of the other columns in between given as args.
+func insertDetail(ctx context.Context, tx *sql.Tx, key util.PRKey, position int, item interface{}, columns string, args ...interface{}) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	values := append([]interface{}{key.Repo, key.Number, position}, args...)
+	values = append(values, string(data))
+	placeholders := "?"
+	for i := 1; i < len(values); i++ {
+		placeholders += ", ?"
+	}
+	_, err = tx.ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s VALUES (%s)", columns, placeholders), // #nosec G201
+		values...)
+	return err
+}
+
+// formatTime returns the time as a string that sorts correctly in
+// SQL queries, or nil for a missing time
+func formatTime(t *time.Time) interface{} {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Result holds the rows returned by a query
+type Result struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// Query runs an arbitrary SQL statement and returns the rows
+func (s *Store) Query(ctx context.Context, query string) (*Result, error) {
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Columns: columns, Rows: [][]interface{}{}}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	return result, rows.Err()
+}
+
+// Repositories returns the sorted names of the repositories with
+// pull requests in the database, limited to Repos when it is set
+func (s *Store) Repositories() []string {
+	repos := []string{}
+	rows, err := s.db.Query("SELECT DISTINCT repo FROM pull_requests ORDER BY repo")
+	if err != nil {
+		return repos
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var repo string
+		if rows.Scan(&repo) == nil && util.InRepositories(s.Repos, repo) {
+			repos = append(repos, repo)
+		}
+	}
+	return repos
+}
+
+// IteratePullRequests invokes the callback for each saved pull
+// request, stopping at the first error.
+func (s *Store) IteratePullRequests(ctx context.Context, callback util.PRCallback) error {
+	// Read all of the pull requests before invoking the callback,
+	// because the callback needs the connection to read details.
+	all := []*github.PullRequest{}
+	err := s.selectJSON(ctx, func() interface{} {
+		pr := &github.PullRequest{}
+		all = append(all, pr)
+		return pr
+	}, "SELECT data FROM pull_requests ORDER BY repo, number DESC")
+	if err != nil {
+		return errors.Wrap(err, "could not read pull requests")
+	}
+	prs := []*github.PullRequest{}
+	for _, pr := range all {
+		if util.InRepositories(s.Repos, util.RepoName(pr)) {
+			prs = append(prs, pr)
+		}
+	}
+
+	return s.Selection.Iterate(ctx, prs, callback)
+}
+
+// selectJSON runs a query returning the data column and decodes each
+// row into the value returned by next
+func (s *Store) selectJSON(ctx context.Context, next func() interface{}, query string, args ...interface{}) error {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(data), next()); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// selectDetails decodes the rows of a detail table for a pull request
+func (s *Store) selectDetails(ctx context.Context, table string, pr *github.PullRequest, next func() interface{}) error {
+	key := util.KeyFor(pr)
+	return s.selectJSON(ctx, next,
+		fmt.Sprintf("SELECT data FROM %s WHERE repo = ? AND number = ? ORDER BY position", table), // #nosec G201
+		key.Repo, key.Number)
+}
+
+func (s *Store) GetPullRequest(ctx context.Context, repo string, number int) (*github.PullRequest, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx,
+		"SELECT data FROM pull_requests WHERE repo = ? AND number = ?", repo, number).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("unknown pull request %s", util.PRKey{Repo: repo, Number: number})
+	}
+	if err != nil {
+		return nil, err
+	}
+	pr := &github.PullRequest{}
+	return pr, json.Unmarshal([]byte(data), pr)
+}
+
+func (s *Store) GetIssueComments(ctx context.Context, pr *github.PullRequest) ([]*github.IssueComment, error) {
+	results := []*github.IssueComment{}
+	err := s.selectDetails(ctx, "issue_comments", pr, func() interface{} {
+		c := &github.IssueComment{}
+		results = append(results, c)
+		return c
+	})
+	return results, err
+}
+
+func (s *Store) GetPRComments(ctx context.Context, pr *github.PullRequest) ([]*github.PullRequestComment, error) {
+	results := []*github.PullRequestComment{}
+	err := s.selectDetails(ctx, "review_comments", pr, func() interface{} {
+		c := &github.PullRequestComment{}
+		results = append(results, c)
+		return c
+	})
+	return results, err
+}
+
+func (s *Store) GetReviews(ctx context.Context, pr *github.PullRequest) ([]*github.PullRequestReview, error) {
+	results := []*github.PullRequestReview{}
+	err := s.selectDetails(ctx, "reviews", pr, func() interface{} {
+		r := &github.PullRequestReview{}
+		results = append(results, r)
+		return r
+	})
+	return results, err
+}
+
+func (s *Store) GetCommits(ctx context.Context, pr *github.PullRequest) ([]*github.RepositoryCommit, error) {
+	results := []*github.RepositoryCommit{}
+	err := s.selectDetails(ctx, "commits", pr, func() interface{} {
+		c := &github.RepositoryCommit{}
+		results = append(results, c)
+		return c
+	})
+	return results, err
+}
+
+func (s *Store) GetTimeline(ctx context.Context, pr *github.PullRequest) ([]*github.Timeline, error) {
+	results := []*github.Timeline{}
+	err := s.selectDetails(ctx, "timeline_events", pr, func() interface{} {
+		e := &github.Timeline{}
+		results = append(results, e)
+		return e
+	})
+	return results, err
+}
+
+func (s *Store) IsMerged(ctx context.Context, pr *github.PullRequest) (bool, error) {
+	key := util.KeyFor(pr)
+	var merged bool
+	err := s.db.QueryRowContext(ctx,
+		"SELECT merged FROM pull_requests WHERE repo = ? AND number = ?",
+		key.Repo, key.Number).Scan(&merged)
+	if err == sql.ErrNoRows {
+		return false, fmt.Errorf("unknown pull request %s", key)
+	}
+	return merged, err
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dhellmann/gh-review-stats/util"
+)
+
+func openTestStore(t *testing.T) *Store {
+	s, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSaveAndRead(t *testing.T) {
+	ctx := context.Background()
+	s := openTestStore(t)
+
+	updated := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	pr := &github.PullRequest{
+		Number:    github.Int(7),
+		State:     github.String("closed"),
+		HTMLURL:   github.String("https://github.com/o/r/pull/7"),
+		UpdatedAt: &updated,
+	}
+	saved := &util.MemoryPullRequest{
+		Pull: pr,
+		Reviews: []*github.PullRequestReview{
+			{ID: github.Int64(2), State: github.String("APPROVED")},
+			{ID: github.Int64(1), State: github.String("COMMENTED")},
+		},
+		IssueComments: []*github.IssueComment{{ID: github.Int64(3)}},
+		Commits:       []*github.RepositoryCommit{{SHA: github.String("abc")}},
+		Merged:        true,
+	}
+	require.NoError(t, s.Save(ctx, saved))
+	// Saving again replaces the details instead of adding to them.
+	require.NoError(t, s.Save(ctx, saved))
+
+	assert.Equal(t, []string{"r"}, s.Repositories())
+
+	when, found, err := s.UpdatedAt(util.KeyFor(pr))
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.True(t, updated.Equal(when))
+
+	_, found, err = s.UpdatedAt(util.PRKey{Repo: "r", Number: 8})
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	seen := []*github.PullRequest{}
+	err = s.IteratePullRequests(ctx, func(ctx context.Context, pr *github.PullRequest) error {
+		seen = append(seen, pr)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(seen))
+
+	fetched, err := util.Fetch(ctx, s, seen[0])
+	require.NoError(t, err)
+	assert.True(t, fetched.Merged)
+	require.Equal(t, 2, len(fetched.Reviews))
+	assert.Equal(t, int64(2), fetched.Reviews[0].GetID())
+	assert.Equal(t, 1, len(fetched.IssueComments))
+	assert.Equal(t, 0, len(fetched.PRComments))
+	assert.Equal(t, "abc", fetched.Commits[0].GetSHA())
+}
+
+func TestRepos(t *testing.T) {
+	ctx := context.Background()
+	s := openTestStore(t)
+	for _, repo := range []string{"a", "b", "c"} {
+		require.NoError(t, s.Save(ctx, &util.MemoryPullRequest{Pull: &github.PullRequest{
+			Number:  github.Int(1),
+			HTMLURL: github.String("https://github.com/o/" + repo + "/pull/1"),
+		}}))
+	}
+
+	s.Repos = []string{"a", "c"}
+	assert.Equal(t, []string{"a", "c"}, s.Repositories())
+	seen := []string{}
+	err := s.IteratePullRequests(ctx, func(ctx context.Context, pr *github.PullRequest) error {
+		seen = append(seen, util.RepoName(pr))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, seen)
+}
+
+func TestWatermark(t *testing.T) {
+	s := openTestStore(t)
+
+	when, err := s.Watermark("r")
+	require.NoError(t, err)
+	assert.True(t, when.IsZero())
+
+	synced := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, s.SetWatermark("r", synced))
+	when, err = s.Watermark("r")
+	require.NoError(t, err)
+	assert.True(t, synced.Equal(when))
+}
+
+func TestSetOrg(t *testing.T) {
+	s := openTestStore(t)
+	require.NoError(t, s.SetOrg("o"))
+	require.NoError(t, s.SetOrg("o"))
+	assert.Error(t, s.SetOrg("other"))
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.db")
+	_, err := OpenReadOnly(filename)
+	assert.Error(t, err, "missing file")
+
+	s, err := Open(filename)
+	require.NoError(t, err)
+	require.NoError(t, s.SetOrg("o"))
+	s.Close()
+
+	s, err = OpenReadOnly(filename)
+	require.NoError(t, err)
+	defer s.Close()
+	org, err := s.Org()
+	require.NoError(t, err)
+	assert.Equal(t, "o", org)
+	assert.Error(t, s.SetOrg("o"))
+}
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+	s := openTestStore(t)
+	require.NoError(t, s.Import(ctx, &util.MemorySource{
+		PullRequests: []*util.MemoryPullRequest{
+			{
+				Pull: &github.PullRequest{
+					Number:  github.Int(1),
+					HTMLURL: github.String("https://github.com/o/r/pull/1"),
+				},
+				Reviews: []*github.PullRequestReview{
+					{User: &github.User{Login: github.String("alice")}, State: github.String("APPROVED")},
+					{User: &github.User{Login: github.String("bob")}, State: github.String("APPROVED")},
+				},
+			},
+		},
+	}))
+
+	result, err := s.Query(ctx, "SELECT author, number FROM reviews WHERE state = 'APPROVED' ORDER BY author")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"author", "number"}, result.Columns)
+	assert.Equal(t, [][]interface{}{{"alice", int64(1)}, {"bob", int64(1)}}, result.Rows)
+
+	_, err = s.Query(ctx, "SELECT * FROM missing")
+	assert.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package teams
+
+import (
+	"time"
+
+	"github.com/dhellmann/gh-review-stats/identity"
+	"github.com/dhellmann/gh-review-stats/stats"
+	"github.com/dhellmann/gh-review-stats/util"
+)
+
+// Summary combines the pull requests written by the members of a
+// team
+type Summary struct {
+	Team           string
+	PullRequests   int
+	Merged         int
+	ReviewActivity int
+
+	// Reviews of the team's pull requests by its own members and
+	// by people on other teams, leaving out the authors and bots
+	ReviewsFromTeam       int
+	ReviewsFromOtherTeams int
+
+	TimeToFirstReview   stats.DurationSummary
+	TimeToFirstApproval stats.DurationSummary
+}
+
+// Summarize rolls up the pull requests by the teams of their
+// authors, in the order of the team names. Pull requests by people
+// on more than one team are counted for each team.
+func (t *Teams) Summarize(requests []*stats.PullRequestDetails, identities *identity.Map) []*Summary {
+	byTeam := map[string]*Summary{}
+	toReview := map[string][]time.Duration{}
+	toApproval := map[string][]time.Duration{}
+	names := []string{}
+
+	for _, prd := range requests {
+		author := identities.User(prd.Pull.User)
+		for _, team := range t.Of(author) {
+			summary, ok := byTeam[team]
+			if !ok {
+				summary = &Summary{Team: team}
+				byTeam[team] = summary
+				names = append(names, team)
+			}
+			summary.PullRequests++
+			if prd.State == "merged" {
+				summary.Merged++
+			}
+			summary.ReviewActivity += prd.AllActivityCount
+
+			for _, review := range prd.Reviews {
+				if util.IsBot(review.User) || identities.Same(review.User, prd.Pull.User) {
+					continue
+				}
+				if contains(t.Of(identities.User(review.User)), team) {
+					summary.ReviewsFromTeam++
+				} else {
+					summary.ReviewsFromOtherTeams++
+				}
+			}
+
+			if prd.TimeToFirstReview != nil {
+				toReview[team] = append(toReview[team], *prd.TimeToFirstReview)
+			}
+			if prd.TimeToFirstApproval != nil {
+				toApproval[team] = append(toApproval[team], *prd.TimeToFirstApproval)
+			}
+		}
+	}
+
+	results := []*Summary{}
+	for _, name := range append(t.Names(), NoTeam) {
+		summary, ok := byTeam[name]
+		if !ok {
+			continue
+		}
+		summary.TimeToFirstReview = stats.SummarizeDurations(toReview[name])
+		summary.TimeToFirstApproval = stats.SummarizeDurations(toApproval[name])
+		results = append(results, summary)
+	}
+	return results
+}
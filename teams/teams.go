@@ -0,0 +1,92 @@
+package teams
+
+import (
+	"sort"
+
+	"github.com/dhellmann/gh-review-stats/identity"
+)
+
+// NoTeam is the name of the group for people who are not on any team
+const NoTeam = "(no team)"
+
+// Team describes a team from the configuration file. The members
+// are listed, or come from a team in the GitHub organization.
+type Team struct {
+	Name       string   `mapstructure:"name"`
+	Members    []string `mapstructure:"members"`
+	GitHubTeam string   `mapstructure:"github-team"`
+}
+
+// Teams tells us which teams people are on
+type Teams struct {
+	names    []string
+	byPerson map[string][]string
+}
+
+// New creates a Teams from the teams, which must already have their
+// members. The members are resolved to people with the identities, so
+// any alias can be used.
+func New(teams []Team, identities *identity.Map) *Teams {
+	t := &Teams{byPerson: map[string][]string{}}
+	seen := map[string]bool{}
+	for _, team := range teams {
+		if !seen[team.Name] {
+			seen[team.Name] = true
+			t.names = append(t.names, team.Name)
+		}
+		for _, member := range team.Members {
+			person := identities.Canonical(member)
+			if !contains(t.byPerson[person], team.Name) {
+				t.byPerson[person] = append(t.byPerson[person], team.Name)
+			}
+		}
+	}
+	sort.Strings(t.names)
+	for _, names := range t.byPerson {
+		sort.Strings(names)
+	}
+	return t
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Names returns the sorted names of the teams
+func (t *Teams) Names() []string {
+	return t.names
+}
+
+// Of returns the teams a person is on, or NoTeam
+func (t *Teams) Of(person string) []string {
+	if names := t.byPerson[person]; len(names) > 0 {
+		return names
+	}
+	return []string{NoTeam}
+}
+
+// RollUp combines interactions between people, indexed by the
+// person acting and then the person acted on, into interactions
+// between their teams. People on more than one team are counted for
+// each team.
+func (t *Teams) RollUp(interactions map[string]map[string]int) map[string]map[string]int {
+	result := map[string]map[string]int{}
+	for from, targets := range interactions {
+		for to, count := range targets {
+			for _, fromTeam := range t.Of(from) {
+				for _, toTeam := range t.Of(to) {
+					if result[fromTeam] == nil {
+						result[fromTeam] = map[string]int{}
+					}
+					result[fromTeam][toTeam] += count
+				}
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+package teams
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dhellmann/gh-review-stats/identity"
+	"github.com/dhellmann/gh-review-stats/stats"
+)
+
+func TestOf(t *testing.T) {
+	ids := identity.New([]identity.Person{
+		{Name: "alice", Logins: []string{"alice", "alice-work"}},
+	})
+	teams := New([]Team{
+		{Name: "web", Members: []string{"alice-work", "bob"}},
+		{Name: "api", Members: []string{"alice"}},
+	}, ids)
+
+	assert.Equal(t, []string{"api", "web"}, teams.Names())
+	assert.Equal(t, []string{"api", "web"}, teams.Of("alice"))
+	assert.Equal(t, []string{"web"}, teams.Of("bob"))
+	assert.Equal(t, []string{NoTeam}, teams.Of("carol"))
+}
+
+func TestRollUp(t *testing.T) {
+	teams := New([]Team{
+		{Name: "web", Members: []string{"alice", "bob"}},
+		{Name: "api", Members: []string{"carol"}},
+	}, nil)
+
+	assert.Equal(t, map[string]map[string]int{
+		"web":  {"web": 2, "api": 3},
+		"api":  {"web": 1},
+		NoTeam: {"api": 4},
+	}, teams.RollUp(map[string]map[string]int{
+		"alice": {"bob": 2, "carol": 3},
+		"carol": {"alice": 1},
+		"dave":  {"carol": 4},
+	}))
+}
+
+func TestSummarize(t *testing.T) {
+	alice := &github.User{Login: github.String("alice")}
+	bob := &github.User{Login: github.String("bob")}
+	carol := &github.User{Login: github.String("carol")}
+	bot := &github.User{Login: github.String("ci"), Type: github.String("Bot")}
+	hour := time.Hour
+
+	teams := New([]Team{
+		{Name: "web", Members: []string{"alice", "bob"}},
+		{Name: "api", Members: []string{"carol"}},
+	}, nil)
+
+	summaries := teams.Summarize([]*stats.PullRequestDetails{
+		{
+			Pull:  &github.PullRequest{User: alice},
+			State: "merged",
+			Reviews: []*github.PullRequestReview{
+				{User: alice}, {User: bob}, {User: carol}, {User: bot},
+			},
+			AllActivityCount:  4,
+			TimeToFirstReview: &hour,
+		},
+		{
+			Pull:             &github.PullRequest{User: &github.User{Login: github.String("dave")}},
+			State:            "open",
+			AllActivityCount: 1,
+		},
+	}, nil)
+
+	require.Equal(t, 2, len(summaries))
+	assert.Equal(t, "web", summaries[0].Team)
+	assert.Equal(t, 1, summaries[0].PullRequests)
+	assert.Equal(t, 1, summaries[0].Merged)
+	assert.Equal(t, 4, summaries[0].ReviewActivity)
+	assert.Equal(t, 1, summaries[0].ReviewsFromTeam)
+	assert.Equal(t, 1, summaries[0].ReviewsFromOtherTeams)
+	assert.Equal(t, hour, summaries[0].TimeToFirstReview.Median)
+	assert.Equal(t, NoTeam, summaries[1].Team)
+	assert.Equal(t, 0, summaries[1].Merged)
+}
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dhellmann/gh-review-stats/logging"
+)
+
+// logTransport is an http.RoundTripper that logs each request sent
+// through base
+type logTransport struct {
+	base http.RoundTripper
+	log  *logging.Logger
+}
+
+// newLogTransport returns a transport logging the requests sent
+// through base, or base itself if the log does not include debug
+// messages
+func newLogTransport(base http.RoundTripper, log *logging.Logger) http.RoundTripper {
+	if !log.Enabled(logging.LevelDebug) {
+		return base
+	}
+	return &logTransport{base: base, log: log}
+}
+
+func (t *logTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+
+	fields := []interface{}{"method", req.Method, "endpoint", req.URL.Path}
+	if page := req.URL.Query().Get("page"); page != "" {
+		fields = append(fields, "page", page)
+	}
+	fields = append(fields, "duration", time.Since(start).Round(time.Millisecond))
+	if err != nil {
+		t.log.Debug("api request failed", append(fields, "err", err)...)
+		return resp, err
+	}
+	fields = append(fields, "status", resp.StatusCode)
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		fields = append(fields, "rate_remaining", remaining)
+	}
+	t.log.Debug("api request", fields...)
+	return resp, nil
+}
@@ -0,0 +1,38 @@
+package util
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dhellmann/gh-review-stats/logging"
+)
+
+func TestLogTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "4990")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	log, err := logging.New(out, logging.LevelDebug, logging.FormatText)
+	require.NoError(t, err)
+	client := &http.Client{Transport: newLogTransport(http.DefaultTransport, log)}
+	resp, err := client.Get(server.URL + "/repos/org/repo/pulls?page=3")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Contains(t, out.String(), "api request method=GET endpoint=/repos/org/repo/pulls page=3 duration=")
+	assert.Contains(t, out.String(), "status=404 rate_remaining=4990\n")
+}
+
+func TestLogTransportNotDebug(t *testing.T) {
+	log, err := logging.New(&bytes.Buffer{}, logging.LevelInfo, logging.FormatText)
+	require.NoError(t, err)
+	assert.Equal(t, http.DefaultTransport, newLogTransport(http.DefaultTransport, log))
+}
@@ -0,0 +1,157 @@
+package util
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// AppCredentials identify a GitHub App installation to authenticate
+// as, instead of using a personal access token.
+type AppCredentials struct {
+	AppID          int64
+	InstallationID int64
+
+	// PrivateKey is the PEM encoded private key of the app
+	PrivateKey []byte
+}
+
+// jwtLifetime is how long the JSON Web Token used to request an
+// installation token is valid. GitHub allows at most 10 minutes.
+const jwtLifetime = 9 * time.Minute
+
+// tokenRefreshMargin is how long before an installation token
+// expires that a new one is requested.
+const tokenRefreshMargin = 5 * time.Minute
+
+// installationTokenSource is an oauth2.TokenSource that exchanges a
+// JSON Web Token signed with the app private key for an installation
+// access token.
+type installationTokenSource struct {
+	ctx   context.Context
+	creds *AppCredentials
+	key   *rsa.PrivateKey
+	opts  ClientOptions
+	base  http.RoundTripper
+	now   func() time.Time
+}
+
+// newAppTokenSource returns a token source that creates installation
+// tokens for the app. Wrapping it with oauth2.ReuseTokenSource means a
+// new token is only requested when the previous one is about to
+// expire.
+func newAppTokenSource(ctx context.Context, creds *AppCredentials, opts ClientOptions, base http.RoundTripper) (oauth2.TokenSource, error) {
+	key, err := parsePrivateKey(creds.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	source := &installationTokenSource{
+		ctx:   ctx,
+		creds: creds,
+		key:   key,
+		opts:  opts,
+		base:  base,
+		now:   time.Now,
+	}
+	return source, nil
+}
+
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("could not decode GitHub App private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse GitHub App private key")
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("GitHub App private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// jwt creates the JSON Web Token that authenticates as the app itself
+func (s *installationTokenSource) jwt() (string, error) {
+	encode := func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data), err
+	}
+
+	// Backdate the token to allow for clock differences with the
+	// server.
+	now := s.now()
+	header, err := encode(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := encode(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(jwtLifetime).Unix(),
+		"iss": fmt.Sprintf("%d", s.creds.AppID),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := header + "." + claims
+	sum := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", errors.Wrap(err, "could not sign GitHub App token")
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Token implements oauth2.TokenSource
+func (s *installationTokenSource) Token() (*oauth2.Token, error) {
+	jwt, err := s.jwt()
+	if err != nil {
+		return nil, err
+	}
+
+	appClient, err := newClient(&http.Client{
+		Transport: &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(
+				&oauth2.Token{AccessToken: jwt, TokenType: "Bearer"},
+			),
+			Base: s.base,
+		},
+	}, s.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	token, _, err := appClient.Apps.CreateInstallationToken(
+		s.ctx, s.creds.InstallationID, nil)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			fmt.Sprintf("could not create token for GitHub App installation %d",
+				s.creds.InstallationID))
+	}
+
+	result := &oauth2.Token{
+		AccessToken: token.GetToken(),
+		TokenType:   "token",
+	}
+	if token.ExpiresAt != nil {
+		result.Expiry = token.ExpiresAt.Add(-tokenRefreshMargin)
+	}
+	return result, nil
+}
@@ -0,0 +1,51 @@
+package util
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppTokenSource(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	var authorization string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v3/app/installations/42/access_tokens" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"token": "installation-token", "expires_at": %q}`,
+			expires.Format(time.RFC3339))
+	})
+
+	source, err := newAppTokenSource(context.Background(),
+		&AppCredentials{AppID: 1, InstallationID: 42, PrivateKey: keyPEM},
+		ClientOptions{BaseURL: client.BaseURL.String()},
+		http.DefaultTransport)
+	require.NoError(t, err)
+
+	token, err := source.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "installation-token", token.AccessToken)
+	assert.Equal(t, expires.Add(-tokenRefreshMargin), token.Expiry)
+	assert.True(t, strings.HasPrefix(authorization, "Bearer "))
+	assert.Equal(t, 3, len(strings.Split(authorization, ".")))
+}
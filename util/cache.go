@@ -0,0 +1,222 @@
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Cache is an on-disk store of GitHub API responses. Entries are
+// keyed by the request URL, which includes the endpoint and page
+// number, and are used to send conditional requests so that
+// unchanged data is served from disk instead of counting against the
+// API rate limit.
+type Cache struct {
+	Dir string
+}
+
+// cacheEntry is the representation of one response saved to disk
+type cacheEntry struct {
+	URL          string      `json:"url"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	StoredAt     time.Time   `json:"stored_at"`
+}
+
+// NewCache returns a Cache that keeps its entries under dir
+func NewCache(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// Transport returns an http.RoundTripper that uses the cache to
+// revalidate GET requests before passing them to base.
+func (c *Cache) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &cacheTransport{cache: c, base: base}
+}
+
+// Prune removes entries that have not been used for longer than
+// maxAge and returns the number of entries removed. A maxAge of 0
+// removes everything.
+func (c *Cache) Prune(maxAge time.Duration) (int, error) {
+	removed := 0
+	cutoff := time.Now().Add(-maxAge)
+	err := filepath.Walk(c.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		if maxAge > 0 && info.ModTime().After(cutoff) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, errors.Wrap(err, "could not prune cache")
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key+".json")
+}
+
+func (c *Cache) load(key string) *cacheEntry {
+	filename := c.path(key)
+	data, err := os.ReadFile(filename) // #nosec G304
+	if err != nil {
+		return nil
+	}
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil
+	}
+	// Record the use so that prune keeps entries that are still
+	// being revalidated.
+	now := time.Now()
+	_ = os.Chtimes(filename, now, now)
+	return entry
+}
+
+func (c *Cache) save(key string, entry *cacheEntry) error {
+	filename := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file and rename it so a reader never
+	// sees a partial entry.
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".entry-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// cacheKey identifies the response to a request. The Accept header is
+// included because GitHub returns different representations of the
+// same resource depending on the media type requested.
+func cacheKey(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.URL.String() + "\n" + req.Header.Get("Accept")))
+	return hex.EncodeToString(sum[:])
+}
+
+type cacheTransport struct {
+	cache *Cache
+	base  http.RoundTripper
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	key := cacheKey(req)
+	entry := t.cache.load(key)
+	if entry != nil {
+		req = req.Clone(req.Context())
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		resp.Body.Close()
+		return entry.response(req, resp), nil
+	}
+
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if resp.StatusCode != http.StatusOK || (etag == "" && lastModified == "") {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	// A failure to write the cache only costs us a request on the
+	// next run, so it is not reported as an error.
+	_ = t.cache.save(key, &cacheEntry{
+		URL:          req.URL.String(),
+		ETag:         etag,
+		LastModified: lastModified,
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header,
+		Body:         body,
+		StoredAt:     time.Now(),
+	})
+
+	return resp, nil
+}
+
+// response rebuilds the saved response for a request that the server
+// has told us is not modified. The rate limit headers come from the
+// fresh response so callers see the current quota.
+func (e *cacheEntry) response(req *http.Request, fresh *http.Response) *http.Response {
+	header := e.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	for name, values := range fresh.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-ratelimit-") {
+			header[name] = values
+		}
+	}
+	header.Set("X-From-Cache", "1")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         fresh.Proto,
+		ProtoMajor:    fresh.ProtoMajor,
+		ProtoMinor:    fresh.ProtoMinor,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
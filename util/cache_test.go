@@ -0,0 +1,64 @@
+package util
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheRevalidates(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-RateLimit-Remaining", "100")
+		if r.Header.Get("If-None-Match") == `"abc"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewCache(t.TempDir()).Transport(nil)}
+
+	get := func() *http.Response {
+		resp, err := client.Get(server.URL + "/repos/o/r/pulls?page=2")
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := get()
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, "", resp.Header.Get("X-From-Cache"))
+
+	resp = get()
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, "1", resp.Header.Get("X-From-Cache"))
+	assert.Equal(t, "100", resp.Header.Get("X-RateLimit-Remaining"))
+	assert.Equal(t, 2, requests)
+}
+
+func TestCachePrune(t *testing.T) {
+	cache := NewCache(t.TempDir())
+	require.NoError(t, cache.save(
+		"0123456789abcdef", &cacheEntry{URL: "http://example.com"}))
+
+	removed, err := cache.Prune(time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 0, removed)
+
+	removed, err = cache.Prune(0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+}
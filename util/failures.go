@@ -0,0 +1,222 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/pkg/errors"
+
+	"github.com/dhellmann/gh-review-stats/logging"
+)
+
+// ErrLeftOut is returned by a callback for a pull request it leaves
+// out of its results on purpose, such as one updated before the
+// dates a report covers. The pull request has not failed, but it is
+// not counted as processed either.
+var ErrLeftOut = errors.New("left out of the results")
+
+// StopError is returned by a callback to stop an iteration at a pull
+// request that could not be processed. Iterating over the pull
+// requests from GitHub logs any other error from a callback and
+// keeps going.
+type StopError struct {
+	Err error
+}
+
+func (e *StopError) Error() string {
+	return e.Err.Error()
+}
+
+// Cause returns the error that stopped the iteration
+func (e *StopError) Cause() error {
+	return e.Err
+}
+
+// isLeftOut reports whether a callback left a pull request out on
+// purpose
+func isLeftOut(err error) bool {
+	return errors.Cause(err) == ErrLeftOut
+}
+
+// asStop returns the StopError that err is or wraps, or nil
+func asStop(err error) *StopError {
+	for err != nil {
+		if stop, ok := err.(*StopError); ok {
+			return stop
+		}
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			return nil
+		}
+		err = cause.Cause()
+	}
+	return nil
+}
+
+// Failure describes a pull request that could not be processed
+type Failure struct {
+	PR  *github.PullRequest
+	Err error
+}
+
+// Failures keeps track of the pull requests a callback could not
+// process, so the iteration can keep going and they can be tried
+// again and reported instead of being left out silently
+type Failures struct {
+	// FailFast stops the iteration at the first failure
+	FailFast bool
+
+	// Log records the pull requests skipped and retried
+	Log *logging.Logger
+
+	processed map[PRKey]bool
+	failed    map[PRKey]*Failure
+	mu        sync.Mutex
+}
+
+// Wrap returns a callback that runs callback and records whether it
+// failed. The failure is only returned, as a StopError stopping the
+// iteration, when FailFast is set. Pull requests interrupted by
+// cancelling the context or left out by the callback are neither
+// processed nor failed.
+func (f *Failures) Wrap(callback PRCallback) PRCallback {
+	return func(ctx context.Context, pr *github.PullRequest) error {
+		err := callback(ctx, pr)
+		if err != nil && ctx.Err() != nil {
+			// The pull request was interrupted rather than failing,
+			// and the iteration stops on its own.
+			return nil
+		}
+		if isLeftOut(err) {
+			return nil
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.init()
+		key := KeyFor(pr)
+		if err != nil {
+			f.Log.Warn("skipping pull request", "pr", key, "err", err)
+			f.failed[key] = &Failure{PR: pr, Err: err}
+			if f.FailFast {
+				return &StopError{Err: err}
+			}
+			return nil
+		}
+		if _, retried := f.failed[key]; retried {
+			f.Log.Info("processed pull request on retry", "pr", key)
+			delete(f.failed, key)
+		}
+		f.processed[key] = true
+		return nil
+	}
+}
+
+func (f *Failures) init() {
+	if f.failed == nil {
+		f.failed = map[PRKey]*Failure{}
+	}
+	if f.processed == nil {
+		f.processed = map[PRKey]bool{}
+	}
+}
+
+// Iterate runs callback for the pull requests from the source,
+// keeping track of the ones that fail, and then tries each of those
+// once more
+func (f *Failures) Iterate(ctx context.Context, source PullRequestSource, callback PRCallback) error {
+	if err := source.IteratePullRequests(ctx, f.Wrap(callback)); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if n := len(f.Failed()); n > 0 {
+		f.Log.Info("retrying pull requests that could not be processed", "count", n)
+	}
+	return f.Retry(ctx, callback)
+}
+
+// Retry runs callback once more for each of the pull requests that
+// failed, forgetting the ones that succeed this time
+func (f *Failures) Retry(ctx context.Context, callback PRCallback) error {
+	wrapped := f.Wrap(callback)
+	for _, failure := range f.Failed() {
+		if err := wrapped(ctx, failure.PR); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Merge adds the pull requests processed by other to f
+func (f *Failures) Merge(other *Failures) {
+	other.mu.Lock()
+	defer other.mu.Unlock()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.init()
+	for key := range other.processed {
+		f.processed[key] = true
+	}
+	for key, failure := range other.failed {
+		f.failed[key] = failure
+	}
+}
+
+// Failed returns the pull requests that could not be processed, in
+// order by repository and number
+func (f *Failures) Failed() []*Failure {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	results := []*Failure{}
+	for _, failure := range f.failed {
+		results = append(results, failure)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := KeyFor(results[i].PR), KeyFor(results[j].PR)
+		if a.Repo != b.Repo {
+			return a.Repo < b.Repo
+		}
+		return a.Number < b.Number
+	})
+	return results
+}
+
+// Completeness describes how many of the pull requests found were
+// processed
+func (f *Failures) Completeness() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	processed := len(f.processed)
+	total := processed + len(f.failed)
+	if total == 0 {
+		return "data completeness: no pull requests found"
+	}
+	return fmt.Sprintf("data completeness: %d of %d pull requests (%.1f%%), %d skipped",
+		processed, total, float64(processed)*100/float64(total), len(f.failed))
+}
+
+// WriteSummary lists the pull requests that were skipped and why
+func (f *Failures) WriteSummary(w io.Writer) {
+	failed := f.Failed()
+	if len(failed) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "skipped %d pull requests:\n", len(failed))
+	for _, failure := range failed {
+		fmt.Fprintf(w, "  %s: %s\n", KeyFor(failure.PR), failure.Err)
+	}
+}
+
+// Err returns an error if any pull requests were skipped
+func (f *Failures) Err() error {
+	if n := len(f.Failed()); n > 0 {
+		return fmt.Errorf("%d pull requests were skipped", n)
+	}
+	return nil
+}
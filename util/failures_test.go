@@ -0,0 +1,135 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dhellmann/gh-review-stats/logging"
+)
+
+func TestFailures(t *testing.T) {
+	source := &MemorySource{
+		PullRequests: []*MemoryPullRequest{
+			{Pull: &github.PullRequest{Number: github.Int(1), HTMLURL: github.String("https://github.com/o/r/pull/1")}},
+			{Pull: &github.PullRequest{Number: github.Int(2), HTMLURL: github.String("https://github.com/o/r/pull/2")}},
+			{Pull: &github.PullRequest{Number: github.Int(3), HTMLURL: github.String("https://github.com/o/r/pull/3")}},
+		},
+	}
+	attempts := map[int]int{}
+	callback := func(ctx context.Context, pr *github.PullRequest) error {
+		attempts[pr.GetNumber()]++
+		switch {
+		case pr.GetNumber() == 2:
+			return errors.New("always fails")
+		case pr.GetNumber() == 3 && attempts[3] == 1:
+			return errors.New("fails once")
+		}
+		return nil
+	}
+
+	f := &Failures{}
+	require.NoError(t, source.IteratePullRequests(context.Background(), f.Wrap(callback)))
+	assert.Equal(t, 2, len(f.Failed()))
+	assert.Equal(t, "data completeness: 1 of 3 pull requests (33.3%), 2 skipped", f.Completeness())
+
+	require.NoError(t, f.Retry(context.Background(), callback))
+	assert.Equal(t, map[int]int{1: 1, 2: 2, 3: 2}, attempts)
+
+	// Iterate does both steps.
+	attempts = map[int]int{}
+	f = &Failures{}
+	require.NoError(t, f.Iterate(context.Background(), source, callback))
+	assert.Equal(t, map[int]int{1: 1, 2: 2, 3: 2}, attempts)
+	assert.Equal(t, "data completeness: 2 of 3 pull requests (66.7%), 1 skipped", f.Completeness())
+
+	summary := &bytes.Buffer{}
+	f.WriteSummary(summary)
+	assert.Equal(t, "skipped 1 pull requests:\n  r#2: always fails\n", summary.String())
+	assert.EqualError(t, f.Err(), "1 pull requests were skipped")
+
+	total := &Failures{}
+	total.Merge(f)
+	total.Merge(&Failures{processed: map[PRKey]bool{{Repo: "s", Number: 1}: true, {Repo: "s", Number: 2}: true}})
+	assert.Equal(t, "data completeness: 4 of 5 pull requests (80.0%), 1 skipped", total.Completeness())
+}
+
+func TestFailuresLeftOut(t *testing.T) {
+	source := &MemorySource{
+		PullRequests: []*MemoryPullRequest{
+			{Pull: &github.PullRequest{Number: github.Int(1), HTMLURL: github.String("https://github.com/o/r/pull/1")}},
+			{Pull: &github.PullRequest{Number: github.Int(2), HTMLURL: github.String("https://github.com/o/r/pull/2")}},
+		},
+	}
+	f := &Failures{}
+	require.NoError(t, f.Iterate(context.Background(), source, func(ctx context.Context, pr *github.PullRequest) error {
+		if pr.GetNumber() == 2 {
+			return ErrLeftOut
+		}
+		return nil
+	}))
+	assert.Equal(t, "data completeness: 1 of 1 pull requests (100.0%), 0 skipped", f.Completeness())
+}
+
+func TestFailuresFailFast(t *testing.T) {
+	source := &MemorySource{
+		PullRequests: []*MemoryPullRequest{
+			{Pull: &github.PullRequest{Number: github.Int(1), HTMLURL: github.String("https://github.com/o/r/pull/1")}},
+			{Pull: &github.PullRequest{Number: github.Int(2), HTMLURL: github.String("https://github.com/o/r/pull/2")}},
+		},
+	}
+	seen := 0
+	f := &Failures{FailFast: true}
+	err := source.IteratePullRequests(context.Background(), f.Wrap(func(ctx context.Context, pr *github.PullRequest) error {
+		seen++
+		return errors.New("fails")
+	}))
+	assert.Error(t, err)
+	assert.Equal(t, 1, seen)
+}
+
+func TestProcessPageStopsOnStopError(t *testing.T) {
+	q := &PullRequestQuery{}
+	prs := []*github.PullRequest{
+		{Number: github.Int(1), HTMLURL: github.String("u1")},
+		{Number: github.Int(2), HTMLURL: github.String("u2")},
+	}
+	more, err := q.processPage(context.Background(), prs, func(ctx context.Context, pr *github.PullRequest) error {
+		return &StopError{Err: errors.New("fails")}
+	})
+	assert.False(t, more)
+	assert.EqualError(t, err, "could not process pull request u1: fails")
+}
+
+func TestProcessPageSkipsErrors(t *testing.T) {
+	out := &bytes.Buffer{}
+	log, err := logging.New(out, logging.LevelInfo, logging.FormatText)
+	require.NoError(t, err)
+	q := &PullRequestQuery{Log: log}
+	prs := []*github.PullRequest{
+		{Number: github.Int(1), HTMLURL: github.String("https://github.com/o/r/pull/1")},
+		{Number: github.Int(2), HTMLURL: github.String("https://github.com/o/r/pull/2")},
+		{Number: github.Int(3), HTMLURL: github.String("https://github.com/o/r/pull/3")},
+	}
+	seen := []int{}
+	more, err := q.processPage(context.Background(), prs, func(ctx context.Context, pr *github.PullRequest) error {
+		seen = append(seen, pr.GetNumber())
+		switch pr.GetNumber() {
+		case 1:
+			return errors.New("fails")
+		case 2:
+			return ErrLeftOut
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.True(t, more)
+	assert.Equal(t, []int{1, 2, 3}, seen)
+	assert.Contains(t, out.String(), "WARN could not process pull request pr=r#1 err=fails\n")
+	assert.NotContains(t, out.String(), "r#2")
+}
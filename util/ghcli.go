@@ -0,0 +1,56 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// ghHostsFile returns the name of the file where the gh command line
+// tool keeps the credentials for each host, following the same rules
+// as gh itself.
+func ghHostsFile() (string, error) {
+	if dir := os.Getenv("GH_CONFIG_DIR"); dir != "" {
+		return filepath.Join(dir, "hosts.yml"), nil
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gh", "hosts.yml"), nil
+	}
+	if dir := os.Getenv("AppData"); runtime.GOOS == "windows" && dir != "" {
+		return filepath.Join(dir, "GitHub CLI", "hosts.yml"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "gh", "hosts.yml"), nil
+}
+
+// GHCLIToken returns the token saved by the gh command line tool
+// for host, or an empty string if gh has not been logged in to the
+// host. Newer versions of gh may keep the token in the system
+// keyring instead, in which case it cannot be found here.
+func GHCLIToken(host string) (string, error) {
+	filename, err := ghHostsFile()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filename) // #nosec G304
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "could not read gh hosts file")
+	}
+
+	hosts := map[string]struct {
+		OAuthToken string `yaml:"oauth_token"`
+	}{}
+	if err := yaml.Unmarshal(data, &hosts); err != nil {
+		return "", errors.Wrap(err, "could not parse gh hosts file")
+	}
+	return hosts[host].OAuthToken, nil
+}
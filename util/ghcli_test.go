@@ -0,0 +1,35 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGHCLIToken(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GH_CONFIG_DIR", dir)
+
+	token, err := GHCLIToken("github.com")
+	require.NoError(t, err)
+	assert.Equal(t, "", token)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hosts.yml"), []byte(`
+github.com:
+    oauth_token: gho_public
+    user: doc
+github.example.com:
+    oauth_token: gho_enterprise
+`), 0600))
+
+	token, err = GHCLIToken("github.com")
+	require.NoError(t, err)
+	assert.Equal(t, "gho_public", token)
+
+	token, err = GHCLIToken("github.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "gho_enterprise", token)
+}
@@ -2,17 +2,131 @@ package util
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
 
 	"github.com/google/go-github/v45/github"
+	"github.com/pkg/errors"
 	"golang.org/x/oauth2"
+
+	"github.com/dhellmann/gh-review-stats/logging"
 )
 
+// ClientOptions holds the settings used by NewGithubClient
+type ClientOptions struct {
+	// Token is the access token used to authenticate to the API
+	Token string
+
+	// CacheDir is the directory where API responses are saved so
+	// they can be revalidated with conditional requests. The cache
+	// is disabled when CacheDir is empty.
+	CacheDir string
+
+	// BaseURL and UploadURL point the client to a GitHub Enterprise
+	// Server instance. When BaseURL is empty the client talks to
+	// GitHub.com. When UploadURL is empty BaseURL is used for both.
+	BaseURL   string
+	UploadURL string
+
+	// CABundle is the name of a file with PEM encoded certificates
+	// to trust in addition to the system certificates, for servers
+	// using self-signed certificates.
+	CABundle string
+
+	// App holds the credentials of a GitHub App installation to
+	// authenticate as. When it is set, Token is ignored.
+	App *AppCredentials
+
+	// Progress, when set, counts the API calls made by the client
+	// and watches the rate limit
+	Progress *Progress
+
+	// Log records each request sent over the network at
+	// logging.LevelDebug, and the waits before retrying requests
+	Log *logging.Logger
+}
+
 // NewGithubClient creates a client for communicating with the GitHub
-// API using the provided token.
-func NewGithubClient(ctx context.Context, token string) *github.Client {
+// API using the provided options.
+func NewGithubClient(ctx context.Context, opts ClientOptions) (*github.Client, error) {
+	base, err := newBaseTransport(opts.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	// Every request sent over the network is counted, including
+	// retries, but not responses served from the cache.
+	base = newLogTransport(opts.Progress.Transport(base), opts.Log)
+
+	// Requests that fail because of rate limits or server errors are
+	// retried before the response reaches the cache or the caller.
+	retry := newRetryTransport(base)
+	retry.log = opts.Log
+	var transport http.RoundTripper = retry
+	if opts.CacheDir != "" {
+		transport = NewCache(opts.CacheDir).Transport(transport)
+	}
+
 	tokenSource := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
+		&oauth2.Token{AccessToken: opts.Token},
 	)
-	oauthClient := oauth2.NewClient(ctx, tokenSource)
-	return github.NewClient(oauthClient)
+	if opts.App != nil {
+		// Installation tokens are requested by a separate client
+		// that authenticates as the app itself.
+		tokenSource, err = newAppTokenSource(ctx, opts.App, opts, newRetryTransport(base))
+		if err != nil {
+			return nil, err
+		}
+	}
+	oauthClient := &http.Client{
+		Transport: &oauth2.Transport{
+			Source: oauth2.ReuseTokenSource(nil, tokenSource),
+			Base:   transport,
+		},
+	}
+
+	return newClient(oauthClient, opts)
+}
+
+// newClient creates a client for GitHub.com or GitHub Enterprise
+// Server, depending on the options, that sends requests with
+// httpClient.
+func newClient(httpClient *http.Client, opts ClientOptions) (*github.Client, error) {
+	if opts.BaseURL == "" {
+		return github.NewClient(httpClient), nil
+	}
+	uploadURL := opts.UploadURL
+	if uploadURL == "" {
+		uploadURL = opts.BaseURL
+	}
+	client, err := github.NewEnterpriseClient(opts.BaseURL, uploadURL, httpClient)
+	return client, errors.Wrap(err, "could not create GitHub Enterprise client")
+}
+
+// newBaseTransport returns the transport used to send requests over
+// the network, trusting the certificates in caBundle if it is set.
+func newBaseTransport(caBundle string) (http.RoundTripper, error) {
+	if caBundle == "" {
+		return http.DefaultTransport, nil
+	}
+
+	pem, err := os.ReadFile(caBundle) // #nosec G304
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read CA bundle")
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("no certificates found in CA bundle %s", caBundle)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+	}
+	return transport, nil
 }
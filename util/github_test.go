@@ -0,0 +1,26 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewGithubClientEnterprise(t *testing.T) {
+	client, err := NewGithubClient(context.Background(), ClientOptions{
+		BaseURL: "https://github.example.com",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.example.com/api/v3/", client.BaseURL.String())
+	assert.Equal(t, "https://github.example.com/api/uploads/", client.UploadURL.String())
+	assert.Equal(t, "https://github.example.com/api/graphql", graphQLURL(client.BaseURL))
+}
+
+func TestNewGithubClientBadCABundle(t *testing.T) {
+	_, err := NewGithubClient(context.Background(), ClientOptions{
+		CABundle: "github_test.go",
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,539 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/pkg/errors"
+)
+
+// graphQLPageSize is the number of pull requests fetched per GraphQL
+// query. It is smaller than the REST page size because each pull
+// request brings its reviews, comments, commits, and timeline along
+// with it.
+const graphQLPageSize int = 25
+
+// graphQLNestedPageSize is the number of reviews, comments, commits,
+// or timeline items fetched with each pull request. When a pull
+// request has more than this, the remaining data is fetched with the
+// REST API.
+const graphQLNestedPageSize int = 50
+
+const pullRequestsGraphQLQuery = `
+query($owner: String!, $repo: String!, $pageSize: Int!, $nestedSize: Int!, $cursor: String,
+      $states: [PullRequestState!], $orderBy: IssueOrder!) {
+  repository(owner: $owner, name: $repo) {
+    pullRequests(first: $pageSize, after: $cursor, states: $states, orderBy: $orderBy) {
+      totalCount
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        databaseId number title url state merged
+        createdAt updatedAt closedAt mergedAt
+        author { ...actor }
+        comments(first: $nestedSize) {
+          pageInfo { hasNextPage }
+          nodes { databaseId url createdAt updatedAt author { ...actor } }
+        }
+        reviews(first: $nestedSize) {
+          pageInfo { hasNextPage }
+          nodes {
+            databaseId url state submittedAt author { ...actor }
+            comments(first: $nestedSize) {
+              pageInfo { hasNextPage }
+              nodes { databaseId url path createdAt updatedAt author { ...actor } }
+            }
+          }
+        }
+        commits(first: $nestedSize) {
+          pageInfo { hasNextPage }
+          nodes {
+            commit {
+              oid url
+              author { name email date user { login name } }
+            }
+          }
+        }
+        timelineItems(first: $nestedSize, itemTypes: [
+          ASSIGNED_EVENT, UNASSIGNED_EVENT, LABELED_EVENT, UNLABELED_EVENT,
+          REVIEW_REQUESTED_EVENT, REVIEW_REQUEST_REMOVED_EVENT, READY_FOR_REVIEW_EVENT,
+          CONVERT_TO_DRAFT_EVENT, HEAD_REF_FORCE_PUSHED_EVENT, REOPENED_EVENT,
+          MERGED_EVENT, CLOSED_EVENT
+        ]) {
+          pageInfo { hasNextPage }
+          nodes {
+            __typename
+            ... on AssignedEvent { createdAt actor { ...actor } assignee { ...actor } }
+            ... on UnassignedEvent { createdAt actor { ...actor } assignee { ...actor } }
+            ... on LabeledEvent { createdAt actor { ...actor } label { name } }
+            ... on UnlabeledEvent { createdAt actor { ...actor } label { name } }
+            ... on ReviewRequestedEvent { createdAt actor { ...actor } requestedReviewer { ...actor } }
+            ... on ReviewRequestRemovedEvent { createdAt actor { ...actor } requestedReviewer { ...actor } }
+            ... on ReadyForReviewEvent { createdAt actor { ...actor } }
+            ... on ConvertToDraftEvent { createdAt actor { ...actor } }
+            ... on HeadRefForcePushedEvent { createdAt actor { ...actor } }
+            ... on ReopenedEvent { createdAt actor { ...actor } }
+            ... on MergedEvent { createdAt actor { ...actor } }
+            ... on ClosedEvent { createdAt actor { ...actor } }
+          }
+        }
+      }
+    }
+  }
+}
+
+fragment actor on Actor {
+  login
+  __typename
+  ... on User { name }
+}
+`
+
+// The gql types mirror the parts of the GraphQL schema used by
+// pullRequestsGraphQLQuery.
+
+type gqlPageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+type gqlActor struct {
+	Login    string `json:"login"`
+	TypeName string `json:"__typename"`
+	Name     string `json:"name"`
+}
+
+type gqlComment struct {
+	DatabaseID int64     `json:"databaseId"`
+	URL        string    `json:"url"`
+	Path       string    `json:"path"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	Author     *gqlActor `json:"author"`
+}
+
+type gqlCommentConnection struct {
+	PageInfo gqlPageInfo   `json:"pageInfo"`
+	Nodes    []*gqlComment `json:"nodes"`
+}
+
+type gqlReview struct {
+	DatabaseID  int64                `json:"databaseId"`
+	URL         string               `json:"url"`
+	State       string               `json:"state"`
+	SubmittedAt *time.Time           `json:"submittedAt"`
+	Author      *gqlActor            `json:"author"`
+	Comments    gqlCommentConnection `json:"comments"`
+}
+
+type gqlCommit struct {
+	Commit struct {
+		OID    string `json:"oid"`
+		URL    string `json:"url"`
+		Author struct {
+			Name  string     `json:"name"`
+			Email string     `json:"email"`
+			Date  *time.Time `json:"date"`
+			User  *gqlActor  `json:"user"`
+		} `json:"author"`
+	} `json:"commit"`
+}
+
+// gqlTimelineEvents maps the types of the timeline items fetched by
+// pullRequestsGraphQLQuery to the names of the events in the REST
+// API. Only the items the reports use are fetched, so a timeline
+// from GraphQL has fewer entries than one from the REST API.
+var gqlTimelineEvents = map[string]string{
+	"AssignedEvent":             "assigned",
+	"UnassignedEvent":           "unassigned",
+	"LabeledEvent":              "labeled",
+	"UnlabeledEvent":            "unlabeled",
+	"ReviewRequestedEvent":      "review_requested",
+	"ReviewRequestRemovedEvent": "review_request_removed",
+	"ReadyForReviewEvent":       "ready_for_review",
+	"ConvertToDraftEvent":       "convert_to_draft",
+	"HeadRefForcePushedEvent":   "head_ref_force_pushed",
+	"ReopenedEvent":             "reopened",
+	"MergedEvent":               "merged",
+	"ClosedEvent":               "closed",
+}
+
+type gqlTimelineItem struct {
+	TypeName  string     `json:"__typename"`
+	CreatedAt *time.Time `json:"createdAt"`
+	Actor     *gqlActor  `json:"actor"`
+	Label     *struct {
+		Name string `json:"name"`
+	} `json:"label"`
+	// Assignee and RequestedReviewer have no login when they are
+	// not people, such as teams asked for a review.
+	Assignee          *gqlActor `json:"assignee"`
+	RequestedReviewer *gqlActor `json:"requestedReviewer"`
+}
+
+type gqlPullRequest struct {
+	DatabaseID int64                `json:"databaseId"`
+	Number     int                  `json:"number"`
+	Title      string               `json:"title"`
+	URL        string               `json:"url"`
+	State      string               `json:"state"`
+	Merged     bool                 `json:"merged"`
+	CreatedAt  *time.Time           `json:"createdAt"`
+	UpdatedAt  *time.Time           `json:"updatedAt"`
+	ClosedAt   *time.Time           `json:"closedAt"`
+	MergedAt   *time.Time           `json:"mergedAt"`
+	Author     *gqlActor            `json:"author"`
+	Comments   gqlCommentConnection `json:"comments"`
+	Reviews    struct {
+		PageInfo gqlPageInfo  `json:"pageInfo"`
+		Nodes    []*gqlReview `json:"nodes"`
+	} `json:"reviews"`
+	Commits struct {
+		PageInfo gqlPageInfo  `json:"pageInfo"`
+		Nodes    []*gqlCommit `json:"nodes"`
+	} `json:"commits"`
+	TimelineItems struct {
+		PageInfo gqlPageInfo        `json:"pageInfo"`
+		Nodes    []*gqlTimelineItem `json:"nodes"`
+	} `json:"timelineItems"`
+}
+
+type gqlPullRequestsResponse struct {
+	Repository *struct {
+		PullRequests struct {
+			TotalCount int               `json:"totalCount"`
+			PageInfo   gqlPageInfo       `json:"pageInfo"`
+			Nodes      []*gqlPullRequest `json:"nodes"`
+		} `json:"pullRequests"`
+	} `json:"repository"`
+}
+
+type gqlError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// prefetchedPR holds the data for one pull request returned by a
+// GraphQL query. A nil slice means the data was incomplete and has to
+// be fetched with the REST API instead.
+type prefetchedPR struct {
+	merged        bool
+	issueComments []*github.IssueComment
+	prComments    []*github.PullRequestComment
+	reviews       []*github.PullRequestReview
+	commits       []*github.RepositoryCommit
+	timeline      []*github.Timeline
+}
+
+// graphQLURL derives the GraphQL endpoint from the REST API base
+// URL of a client. GitHub.com serves GraphQL from /graphql, while
+// GitHub Enterprise Server uses /api/graphql next to /api/v3.
+func graphQLURL(base *url.URL) string {
+	u := *base
+	if strings.HasSuffix(u.Path, "/api/v3/") {
+		u.Path = strings.TrimSuffix(u.Path, "v3/") + "graphql"
+	} else {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/graphql"
+	}
+	return u.String()
+}
+
+// graphQL sends a query to the GraphQL API and decodes the data
+// portion of the response into result.
+func (q *PullRequestQuery) graphQL(ctx context.Context, query string, variables map[string]interface{}, result interface{}) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		graphQLURL(q.Client.BaseURL), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := q.Client.Client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GraphQL query failed: %s", resp.Status)
+	}
+
+	body := struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []gqlError      `json:"errors"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return errors.Wrap(err, "could not decode GraphQL response")
+	}
+	if len(body.Errors) > 0 {
+		messages := []string{}
+		for _, e := range body.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("GraphQL query failed: %s", strings.Join(messages, "; "))
+	}
+	return json.Unmarshal(body.Data, result)
+}
+
+// iterateGraphQL is the GraphQL implementation of iterateList. Each
+// page of pull requests is fetched with their reviews, comments,
+// commits, timeline, and merged state so that the other methods of
+// the query do not need to call the API again.
+func (q *PullRequestQuery) iterateGraphQL(ctx context.Context, repo, state string, callback PRCallback) (bool, error) {
+	variables := map[string]interface{}{
+		"owner":      q.Org,
+		"repo":       repo,
+		"pageSize":   graphQLPageSize,
+		"nestedSize": graphQLNestedPageSize,
+		"cursor":     nil,
+		"states":     nil,
+		"orderBy":    map[string]string{"field": "CREATED_AT", "direction": "DESC"},
+	}
+	switch state {
+	case "open":
+		variables["states"] = []string{"OPEN"}
+	case "closed":
+		variables["states"] = []string{"CLOSED", "MERGED"}
+		variables["orderBy"] = map[string]string{"field": "UPDATED_AT", "direction": "DESC"}
+	}
+
+	position, finished := q.resumeFrom(repo, state)
+	if finished {
+		return true, nil
+	}
+	if position != "" {
+		variables["cursor"] = position
+	}
+
+	listed := 0
+	for {
+		result := gqlPullRequestsResponse{}
+		err := q.graphQL(ctx, pullRequestsGraphQLQuery, variables, &result)
+		if err != nil {
+			return false, errors.Wrap(err,
+				fmt.Sprintf(
+					"could not get pull requests for %s/%s", q.Org, repo))
+		}
+		if result.Repository == nil {
+			return false, fmt.Errorf("could not find repository %s/%s", q.Org, repo)
+		}
+
+		connection := result.Repository.PullRequests
+		prs := []*github.PullRequest{}
+		for _, node := range connection.Nodes {
+			prs = append(prs, node.pullRequest(q.Org, repo))
+		}
+		done := false
+		if state == "closed" {
+			prs, done = q.updatedSince(prs)
+		}
+		listed += len(prs)
+		q.expect(repo, state, listed, connection.TotalCount, prs,
+			done || !connection.PageInfo.HasNextPage)
+		q.logPage(repo, state, "cursor", variables["cursor"], prs, done)
+		for i, pr := range prs {
+			q.setPrefetched(KeyFor(pr), connection.Nodes[i].prefetched())
+		}
+		more, err := q.handlePage(ctx, prs, callback)
+		for _, pr := range prs {
+			q.setPrefetched(KeyFor(pr), nil)
+		}
+		if !more {
+			return false, err
+		}
+
+		if done || !connection.PageInfo.HasNextPage {
+			q.reachedPage(repo, state, PositionDone)
+			return true, nil
+		}
+		q.reachedPage(repo, state, connection.PageInfo.EndCursor)
+		variables["cursor"] = connection.PageInfo.EndCursor
+	}
+}
+
+func (q *PullRequestQuery) setPrefetched(key PRKey, data *prefetchedPR) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if data == nil {
+		delete(q.prefetched, key)
+		return
+	}
+	if q.prefetched == nil {
+		q.prefetched = map[PRKey]*prefetchedPR{}
+	}
+	q.prefetched[key] = data
+}
+
+func (q *PullRequestQuery) getPrefetched(pr *github.PullRequest) *prefetchedPR {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.prefetched[KeyFor(pr)]
+}
+
+func (a *gqlActor) user() *github.User {
+	if a == nil {
+		return nil
+	}
+	u := &github.User{
+		Login: github.String(a.Login),
+	}
+	if a.TypeName != "" {
+		u.Type = github.String(a.TypeName)
+	}
+	if a.Name != "" {
+		u.Name = github.String(a.Name)
+	}
+	return u
+}
+
+// person returns the user for an actor that is a person or a bot,
+// and nil for other actors such as teams
+func (a *gqlActor) person() *github.User {
+	if a == nil || a.Login == "" {
+		return nil
+	}
+	return a.user()
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (n *gqlPullRequest) pullRequest(org, repo string) *github.PullRequest {
+	// The REST API reports merged pull requests as closed.
+	state := strings.ToLower(n.State)
+	if state == "merged" {
+		state = "closed"
+	}
+	return &github.PullRequest{
+		ID:        github.Int64(n.DatabaseID),
+		Number:    github.Int(n.Number),
+		Title:     github.String(n.Title),
+		HTMLURL:   github.String(n.URL),
+		State:     github.String(state),
+		Merged:    github.Bool(n.Merged),
+		CreatedAt: n.CreatedAt,
+		UpdatedAt: n.UpdatedAt,
+		ClosedAt:  n.ClosedAt,
+		MergedAt:  n.MergedAt,
+		User:      n.Author.user(),
+		Base: &github.PullRequestBranch{
+			Repo: &github.Repository{
+				Name:  github.String(repo),
+				Owner: &github.User{Login: github.String(org)},
+			},
+		},
+	}
+}
+
+func (n *gqlPullRequest) prefetched() *prefetchedPR {
+	result := &prefetchedPR{
+		merged: n.Merged,
+	}
+
+	if !n.Comments.PageInfo.HasNextPage {
+		result.issueComments = []*github.IssueComment{}
+		for _, c := range n.Comments.Nodes {
+			result.issueComments = append(result.issueComments, &github.IssueComment{
+				ID:        github.Int64(c.DatabaseID),
+				HTMLURL:   github.String(c.URL),
+				CreatedAt: timePtr(c.CreatedAt),
+				UpdatedAt: timePtr(c.UpdatedAt),
+				User:      c.Author.user(),
+			})
+		}
+	}
+
+	if !n.Reviews.PageInfo.HasNextPage {
+		result.reviews = []*github.PullRequestReview{}
+		result.prComments = []*github.PullRequestComment{}
+		for _, r := range n.Reviews.Nodes {
+			result.reviews = append(result.reviews, &github.PullRequestReview{
+				ID:          github.Int64(r.DatabaseID),
+				HTMLURL:     github.String(r.URL),
+				State:       github.String(r.State),
+				SubmittedAt: r.SubmittedAt,
+				User:        r.Author.user(),
+			})
+			if r.Comments.PageInfo.HasNextPage {
+				// Some review comments are missing, so let the
+				// REST API find all of them.
+				result.prComments = nil
+			}
+			if result.prComments == nil {
+				continue
+			}
+			for _, c := range r.Comments.Nodes {
+				result.prComments = append(result.prComments, &github.PullRequestComment{
+					ID:                  github.Int64(c.DatabaseID),
+					HTMLURL:             github.String(c.URL),
+					Path:                github.String(c.Path),
+					CreatedAt:           timePtr(c.CreatedAt),
+					UpdatedAt:           timePtr(c.UpdatedAt),
+					User:                c.Author.user(),
+					PullRequestReviewID: github.Int64(r.DatabaseID),
+				})
+			}
+		}
+	}
+
+	if !n.Commits.PageInfo.HasNextPage {
+		result.commits = []*github.RepositoryCommit{}
+		for _, c := range n.Commits.Nodes {
+			commit := &github.RepositoryCommit{
+				SHA:     github.String(c.Commit.OID),
+				HTMLURL: github.String(c.Commit.URL),
+				Commit: &github.Commit{
+					SHA: github.String(c.Commit.OID),
+					Author: &github.CommitAuthor{
+						Name:  github.String(c.Commit.Author.Name),
+						Email: github.String(c.Commit.Author.Email),
+						Date:  c.Commit.Author.Date,
+					},
+				},
+				Author: c.Commit.Author.User.user(),
+			}
+			result.commits = append(result.commits, commit)
+		}
+	}
+
+	if !n.TimelineItems.PageInfo.HasNextPage {
+		result.timeline = []*github.Timeline{}
+		for _, item := range n.TimelineItems.Nodes {
+			event, ok := gqlTimelineEvents[item.TypeName]
+			if !ok {
+				continue
+			}
+			entry := &github.Timeline{
+				Event:     github.String(event),
+				CreatedAt: item.CreatedAt,
+				Actor:     item.Actor.person(),
+				Assignee:  item.Assignee.person(),
+				Reviewer:  item.RequestedReviewer.person(),
+			}
+			if item.Label != nil {
+				entry.Label = &github.Label{Name: github.String(item.Label.Name)}
+			}
+			result.timeline = append(result.timeline, entry)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,103 @@
+package util
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const graphQLTestResponse = `{"data": {"repository": {"pullRequests": {
+  "pageInfo": {"hasNextPage": false, "endCursor": "x"},
+  "nodes": [{
+    "databaseId": 1, "number": 7, "title": "a change", "url": "https://github.com/o/r/pull/7",
+    "state": "MERGED", "merged": true,
+    "createdAt": "2022-01-01T00:00:00Z", "updatedAt": "2022-01-02T00:00:00Z",
+    "author": {"login": "author", "__typename": "User"},
+    "comments": {"pageInfo": {"hasNextPage": true}, "nodes": []},
+    "reviews": {"pageInfo": {"hasNextPage": false}, "nodes": [{
+      "databaseId": 2, "state": "APPROVED", "submittedAt": "2022-01-02T00:00:00Z",
+      "author": {"login": "reviewer", "__typename": "User"},
+      "comments": {"pageInfo": {"hasNextPage": false}, "nodes": [
+        {"databaseId": 3, "path": "README.md", "createdAt": "2022-01-02T00:00:00Z",
+         "author": {"login": "reviewer", "__typename": "User"}}
+      ]}
+    }]},
+    "commits": {"pageInfo": {"hasNextPage": false}, "nodes": []},
+    "timelineItems": {"pageInfo": {"hasNextPage": false}, "nodes": [
+      {"__typename": "ReviewRequestedEvent", "createdAt": "2022-01-01T01:00:00Z",
+       "actor": {"login": "author", "__typename": "User"},
+       "requestedReviewer": {"login": "reviewer", "__typename": "User"}},
+      {"__typename": "ReviewRequestedEvent", "createdAt": "2022-01-01T01:00:00Z",
+       "actor": {"login": "author", "__typename": "User"}, "requestedReviewer": {}},
+      {"__typename": "LabeledEvent", "createdAt": "2022-01-01T02:00:00Z",
+       "actor": {"login": "author", "__typename": "User"}, "label": {"name": "bug"}}
+    ]}
+  }]
+}}}}`
+
+func TestGraphQLURL(t *testing.T) {
+	for base, expected := range map[string]string{
+		"https://api.github.com/":            "https://api.github.com/graphql",
+		"https://github.example.com/api/v3/": "https://github.example.com/api/graphql",
+	} {
+		u, err := url.Parse(base)
+		require.NoError(t, err)
+		assert.Equal(t, expected, graphQLURL(u))
+	}
+}
+
+func TestIterateGraphQL(t *testing.T) {
+	restCalls := 0
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/graphql" {
+			w.Write([]byte(graphQLTestResponse))
+			return
+		}
+		restCalls++
+		w.Write([]byte("[]"))
+	})
+
+	q := &PullRequestQuery{Org: "o", Repos: []string{"r"}, Client: client, GraphQL: true}
+
+	seen := 0
+	err := q.IteratePullRequests(context.Background(), func(ctx context.Context, pr *github.PullRequest) error {
+		seen++
+		assert.Equal(t, 7, *pr.Number)
+		assert.Equal(t, "closed", *pr.State)
+
+		merged, err := q.IsMerged(ctx, pr)
+		require.NoError(t, err)
+		assert.True(t, merged)
+
+		reviews, err := q.GetReviews(ctx, pr)
+		require.NoError(t, err)
+		assert.Equal(t, 1, len(reviews))
+		assert.Equal(t, "APPROVED", *reviews[0].State)
+
+		comments, err := q.GetPRComments(ctx, pr)
+		require.NoError(t, err)
+		assert.Equal(t, 1, len(comments))
+
+		timeline, err := q.GetTimeline(ctx, pr)
+		require.NoError(t, err)
+		require.Equal(t, 3, len(timeline))
+		assert.Equal(t, "review_requested", timeline[0].GetEvent())
+		assert.Equal(t, "reviewer", timeline[0].GetReviewer().GetLogin())
+		// Teams asked for a review have no login.
+		assert.Nil(t, timeline[1].Reviewer)
+		assert.Equal(t, "bug", timeline[2].GetLabel().GetName())
+
+		// The issue comments were incomplete, so they come from REST.
+		_, err = q.GetIssueComments(ctx, pr)
+		require.NoError(t, err)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, seen)
+	assert.Equal(t, 1, restCalls)
+}
@@ -0,0 +1,153 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/google/go-github/v45/github"
+)
+
+// MemoryPullRequest holds a pull request and all of its details
+type MemoryPullRequest struct {
+	Pull          *github.PullRequest          `json:"pull"`
+	IssueComments []*github.IssueComment       `json:"issue_comments"`
+	PRComments    []*github.PullRequestComment `json:"pr_comments"`
+	Reviews       []*github.PullRequestReview  `json:"reviews"`
+	Commits       []*github.RepositoryCommit   `json:"commits"`
+	Timeline      []*github.Timeline           `json:"timeline"`
+	Merged        bool                         `json:"merged"`
+}
+
+// MemorySource is a PullRequestSource that serves pull requests
+// held in memory, for tests and for data loaded from other places
+type MemorySource struct {
+	PullRequests []*MemoryPullRequest
+
+	// Selection, when set, limits the pull requests iterated over
+	Selection *Selection
+
+	// Repos, when set, limits the pull requests iterated over to
+	// the ones in these repositories
+	Repos []string
+
+	// index finds the pull requests by key, covering the first
+	// indexed entries of PullRequests
+	index   map[PRKey]*MemoryPullRequest
+	indexed int
+	mu      sync.Mutex
+}
+
+// IteratePullRequests invokes the callback for each pull request in
+// order, stopping at the first error.
+func (m *MemorySource) IteratePullRequests(ctx context.Context, callback PRCallback) error {
+	prs := []*github.PullRequest{}
+	for _, p := range m.PullRequests {
+		if InRepositories(m.Repos, RepoName(p.Pull)) {
+			prs = append(prs, p.Pull)
+		}
+	}
+	return m.Selection.Iterate(ctx, prs, callback)
+}
+
+// Repositories returns the sorted names of the repositories of the
+// pull requests, limited to Repos when it is set
+func (m *MemorySource) Repositories() []string {
+	seen := map[string]bool{}
+	repos := []string{}
+	for _, p := range m.PullRequests {
+		name := RepoName(p.Pull)
+		if !seen[name] && InRepositories(m.Repos, name) {
+			seen[name] = true
+			repos = append(repos, name)
+		}
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+func (m *MemorySource) GetPullRequest(ctx context.Context, repo string, number int) (*github.PullRequest, error) {
+	p, err := m.find(&github.PullRequest{
+		Number: github.Int(number),
+		Base: &github.PullRequestBranch{
+			Repo: &github.Repository{Name: github.String(repo)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p.Pull, nil
+}
+
+// find returns the saved details of the pull request. The index is
+// built the first time it is needed and extended when pull requests
+// are appended. If a pull request appears more than once, the first
+// one is used.
+func (m *MemorySource) find(pr *github.PullRequest) (*MemoryPullRequest, error) {
+	key := KeyFor(pr)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.index == nil || m.indexed > len(m.PullRequests) {
+		m.index = map[PRKey]*MemoryPullRequest{}
+		m.indexed = 0
+	}
+	for _, p := range m.PullRequests[m.indexed:] {
+		if _, ok := m.index[KeyFor(p.Pull)]; !ok {
+			m.index[KeyFor(p.Pull)] = p
+		}
+	}
+	m.indexed = len(m.PullRequests)
+	if p, ok := m.index[key]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("unknown pull request %s", key)
+}
+
+func (m *MemorySource) GetIssueComments(ctx context.Context, pr *github.PullRequest) ([]*github.IssueComment, error) {
+	p, err := m.find(pr)
+	if err != nil {
+		return nil, err
+	}
+	return p.IssueComments, nil
+}
+
+func (m *MemorySource) GetPRComments(ctx context.Context, pr *github.PullRequest) ([]*github.PullRequestComment, error) {
+	p, err := m.find(pr)
+	if err != nil {
+		return nil, err
+	}
+	return p.PRComments, nil
+}
+
+func (m *MemorySource) GetReviews(ctx context.Context, pr *github.PullRequest) ([]*github.PullRequestReview, error) {
+	p, err := m.find(pr)
+	if err != nil {
+		return nil, err
+	}
+	return p.Reviews, nil
+}
+
+func (m *MemorySource) GetCommits(ctx context.Context, pr *github.PullRequest) ([]*github.RepositoryCommit, error) {
+	p, err := m.find(pr)
+	if err != nil {
+		return nil, err
+	}
+	return p.Commits, nil
+}
+
+func (m *MemorySource) GetTimeline(ctx context.Context, pr *github.PullRequest) ([]*github.Timeline, error) {
+	p, err := m.find(pr)
+	if err != nil {
+		return nil, err
+	}
+	return p.Timeline, nil
+}
+
+func (m *MemorySource) IsMerged(ctx context.Context, pr *github.PullRequest) (bool, error) {
+	p, err := m.find(pr)
+	if err != nil {
+		return false, err
+	}
+	return p.Merged, nil
+}
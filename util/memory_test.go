@@ -0,0 +1,42 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMemoryPullRequest(repo string, number int) *MemoryPullRequest {
+	return &MemoryPullRequest{
+		Pull: &github.PullRequest{
+			Number: github.Int(number),
+			Base: &github.PullRequestBranch{
+				Repo: &github.Repository{Name: github.String(repo)},
+			},
+		},
+		Merged: number%2 == 0,
+	}
+}
+
+func TestMemorySourceFind(t *testing.T) {
+	ctx := context.Background()
+	m := &MemorySource{PullRequests: []*MemoryPullRequest{
+		newMemoryPullRequest("a", 1),
+		newMemoryPullRequest("b", 1),
+	}}
+
+	pr, err := m.GetPullRequest(ctx, "b", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "b", RepoName(pr))
+	_, err = m.GetPullRequest(ctx, "a", 2)
+	assert.Error(t, err)
+
+	// Pull requests appended after the first lookup are found too.
+	m.PullRequests = append(m.PullRequests, newMemoryPullRequest("a", 2))
+	merged, err := m.IsMerged(ctx, m.PullRequests[2].Pull)
+	require.NoError(t, err)
+	assert.True(t, merged)
+}
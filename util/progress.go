@@ -0,0 +1,253 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProgressInterval is how often a line is written to show the
+// progress when the output is not a terminal
+const DefaultProgressInterval = 30 * time.Second
+
+// redrawInterval limits how often the status line is redrawn on a
+// terminal
+const redrawInterval = 100 * time.Millisecond
+
+// Progress shows how far an iteration through the pull requests has
+// got: the pull requests processed out of the number expected, the
+// API calls made, the remaining rate limit, and an estimate of the
+// time left. On a terminal a status line is redrawn in place,
+// otherwise a line is written every Interval.
+//
+// Messages written to a Progress, as an io.Writer, are not mixed up
+// with the status line. A nil Progress shows nothing.
+type Progress struct {
+	// Out is where the progress is written
+	Out io.Writer
+
+	// Interactive redraws a status line in place instead of writing
+	// a line every Interval
+	Interactive bool
+
+	// Interval is how often a line is written when Interactive is
+	// false
+	Interval time.Duration
+
+	expected  map[string]int
+	max       int
+	processed int
+	apiCalls  int
+	rateLimit int
+	rateLeft  int
+	start     time.Time
+	lastShown time.Time
+	drawn     bool
+	now       func() time.Time
+	mu        sync.Mutex
+}
+
+// NewProgress creates a Progress writing to out, redrawing a status
+// line when out is a terminal
+func NewProgress(out io.Writer) *Progress {
+	p := &Progress{
+		Out:      out,
+		Interval: DefaultProgressInterval,
+		expected: map[string]int{},
+		rateLeft: -1,
+		now:      time.Now,
+	}
+	p.start = p.now()
+	p.lastShown = p.start
+	if f, ok := out.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			p.Interactive = true
+		}
+	}
+	return p
+}
+
+// Expect sets the number of pull requests a listing is expected to
+// produce, replacing any earlier guess for the same key. The total
+// shown is the sum for all of the listings.
+func (p *Progress) Expect(key string, count int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expected[key] = count
+	p.show(false)
+}
+
+// Cap limits the total shown, for iterations stopping after a number
+// of pull requests. Zero means there is no cap.
+func (p *Progress) Cap(count int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.max = count
+}
+
+// Done counts a pull request as processed
+func (p *Progress) Done() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.processed++
+	p.show(false)
+}
+
+// Write writes output, such as log messages, clearing the status line
+// first and drawing it again after
+func (p *Progress) Write(b []byte) (int, error) {
+	if p == nil {
+		return os.Stderr.Write(b)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.drawn {
+		fmt.Fprintf(p.Out, "\r\x1b[K")
+		p.drawn = false
+	}
+	n, err := p.Out.Write(b)
+	p.show(true)
+	return n, err
+}
+
+// Finish shows the final progress, once the iteration is over
+func (p *Progress) Finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Interactive {
+		p.show(true)
+		if p.drawn {
+			fmt.Fprintf(p.Out, "\n")
+			p.drawn = false
+		}
+		return
+	}
+	fmt.Fprintf(p.Out, "processed %d pull requests with %d API calls in %s\n",
+		p.processed, p.apiCalls, p.now().Sub(p.start).Round(time.Second))
+}
+
+// Transport returns an http.RoundTripper that counts the API calls
+// sent through base and watches the rate limit in the responses
+func (p *Progress) Transport(base http.RoundTripper) http.RoundTripper {
+	if p == nil {
+		return base
+	}
+	return &progressTransport{base: base, progress: p}
+}
+
+type progressTransport struct {
+	base     http.RoundTripper
+	progress *Progress
+}
+
+func (t *progressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		t.progress.apiCall(resp)
+	}
+	return resp, err
+}
+
+// apiCall counts a request and records the rate limit it reports
+func (p *Progress) apiCall(resp *http.Response) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.apiCalls++
+	if left, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		p.rateLeft = left
+	}
+	if limit, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit")); err == nil {
+		p.rateLimit = limit
+	}
+	p.show(false)
+}
+
+// total returns the number of pull requests expected
+func (p *Progress) total() int {
+	total := 0
+	for _, count := range p.expected {
+		total += count
+	}
+	if p.max > 0 && total > p.max {
+		total = p.max
+	}
+	if total > 0 && total < p.processed {
+		// The guesses were too low.
+		total = p.processed
+	}
+	return total
+}
+
+// status describes the progress so far
+func (p *Progress) status() string {
+	parts := []string{}
+	total := p.total()
+	if total > 0 {
+		parts = append(parts, fmt.Sprintf("%d/%d pull requests (%d%%)",
+			p.processed, total, p.processed*100/total))
+	} else {
+		parts = append(parts, fmt.Sprintf("%d pull requests", p.processed))
+	}
+	parts = append(parts, fmt.Sprintf("%d API calls", p.apiCalls))
+	if p.rateLeft >= 0 {
+		if p.rateLimit > 0 {
+			parts = append(parts, fmt.Sprintf("rate limit %d/%d left", p.rateLeft, p.rateLimit))
+		} else {
+			parts = append(parts, fmt.Sprintf("rate limit %d left", p.rateLeft))
+		}
+	}
+	if eta, ok := p.eta(total); ok {
+		parts = append(parts, fmt.Sprintf("ETA %s", eta))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// eta estimates the time left from the rate pull requests have been
+// processed at so far
+func (p *Progress) eta(total int) (time.Duration, bool) {
+	if p.processed == 0 || total <= p.processed {
+		return 0, false
+	}
+	elapsed := p.now().Sub(p.start)
+	perPR := elapsed / time.Duration(p.processed)
+	return (perPR * time.Duration(total-p.processed)).Round(time.Second), true
+}
+
+// show writes the progress if it is due, or if force is set. The
+// caller must hold the lock.
+func (p *Progress) show(force bool) {
+	now := p.now()
+	if p.Interactive {
+		if !force && now.Sub(p.lastShown) < redrawInterval {
+			return
+		}
+		fmt.Fprintf(p.Out, "\r\x1b[K%s", p.status())
+		p.drawn = true
+		p.lastShown = now
+		return
+	}
+	if force || now.Sub(p.lastShown) < p.Interval {
+		// Messages are not followed by a progress line when the
+		// output is a log.
+		return
+	}
+	fmt.Fprintf(p.Out, "progress: %s\n", p.status())
+	p.lastShown = now
+}
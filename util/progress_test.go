@@ -0,0 +1,101 @@
+package util
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestProgress(out *bytes.Buffer, now *time.Time) *Progress {
+	p := NewProgress(out)
+	p.now = func() time.Time { return *now }
+	p.start = *now
+	p.lastShown = *now
+	return p
+}
+
+func TestProgressStatus(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	out := &bytes.Buffer{}
+	p := newTestProgress(out, &now)
+
+	p.Expect("r/open", 10)
+	p.Expect("r/closed", 40)
+	p.Expect("r/closed", 30)
+	for i := 0; i < 10; i++ {
+		p.Done()
+	}
+	now = now.Add(time.Minute)
+	assert.Equal(t, "10/40 pull requests (25%), 0 API calls, ETA 3m0s", p.status())
+
+	p.Cap(20)
+	assert.Equal(t, "10/20 pull requests (50%), 0 API calls, ETA 1m0s", p.status())
+
+	var none *Progress
+	none.Done()
+	none.Expect("r/open", 1)
+	none.Finish()
+}
+
+func TestProgressLog(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	out := &bytes.Buffer{}
+	p := newTestProgress(out, &now)
+	require.False(t, p.Interactive)
+
+	p.Done()
+	assert.Equal(t, "", out.String(), "nothing is written before the interval")
+
+	now = now.Add(DefaultProgressInterval)
+	p.Done()
+	assert.Equal(t, "progress: 2 pull requests, 0 API calls\n", out.String())
+
+	out.Reset()
+	p.Finish()
+	assert.Equal(t, "processed 2 pull requests with 0 API calls in 30s\n", out.String())
+}
+
+func TestProgressTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "4990")
+		w.Header().Set("X-RateLimit-Limit", "5000")
+	}))
+	defer server.Close()
+
+	p := NewProgress(&bytes.Buffer{})
+	client := &http.Client{Transport: p.Transport(http.DefaultTransport)}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, "0 pull requests, 2 API calls, rate limit 4990/5000 left", p.status())
+}
+
+func TestExpectClosed(t *testing.T) {
+	p := NewProgress(&bytes.Buffer{})
+	q := &PullRequestQuery{
+		Progress: p,
+		Since:    time.Now().Add(-100 * time.Hour),
+	}
+	updated := time.Now().Add(-25 * time.Hour)
+	prs := []*github.PullRequest{{UpdatedAt: &updated}}
+
+	// A quarter of the time has been covered, so there should be
+	// about 4 times as many pull requests.
+	q.expect("r", "closed", 50, 1000, prs, false)
+	assert.InDelta(t, 200, p.total(), 1)
+
+	// The estimate is never more than the listing holds.
+	q.expect("r", "closed", 50, 150, prs, false)
+	assert.Equal(t, 150, p.total())
+
+	q.expect("r", "closed", 60, 150, prs, true)
+	assert.Equal(t, 60, p.total())
+}
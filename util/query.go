@@ -3,82 +3,528 @@ package util
 import (
 	"context"
 	"fmt"
-	"os"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/google/go-github/v45/github"
 	"github.com/pkg/errors"
+
+	"github.com/dhellmann/gh-review-stats/logging"
 )
 
 // PullRequestQuery holds the parameters for iterating over pull requests
 type PullRequestQuery struct {
-	Org     string
-	Repo    string
-	DevMode bool
-	Client  *github.Client
+	Org    string
+	Repos  []string
+	Client *github.Client
+
+	// Progress, when set, shows how far the iteration has got
+	Progress *Progress
+
+	// Log records the pages listed and why pull requests are left
+	// out, at logging.LevelDebug
+	Log *logging.Logger
+
+	// Selection, when set, limits the pull requests processed. When
+	// it has a Limit or a Sample, Resume and OnPage are not used
+	// because the pull requests have to be listed from the beginning
+	// to select the same ones again.
+	Selection *Selection
+
+	// GraphQL tells the query to fetch pull requests and their
+	// details with the GraphQL API instead of making several REST
+	// calls for each pull request.
+	GraphQL bool
+
+	// Concurrency is the number of pull requests processed at the
+	// same time. Values less than 1 are treated as 1.
+	Concurrency int
+
+	// Since limits the closed pull requests returned to those
+	// updated on or after the date, so we do not have to page
+	// through the entire history of a repository. Open pull
+	// requests are always returned. All pull requests are returned
+	// when Since is zero.
+	Since time.Time
+
+	// Search tells the query to use the search API to find the
+	// closed pull requests updated since the Since date.
+	Search bool
+
+	// Resume holds the positions to continue listing pull requests
+	// from after an interrupted iteration, indexed by the keys
+	// given to OnPage. Listings with no position start from the
+	// beginning. The search API cannot be resumed this way.
+	//
+	// The closed pull requests are listed with the most recently
+	// updated first, so a pull request updated after the
+	// interruption moves to a page that was already finished. Those
+	// listings are only skipped once they are done, and otherwise
+	// start from the beginning again, leaving it to the callback to
+	// skip the pull requests it has already seen.
+	Resume map[string]string
+
+	// OnPage, when set, is called after each page of pull requests
+	// has been processed with the key of the listing and the
+	// position to continue from, or PositionDone when there are no
+	// more pages. Listings of closed pull requests only report
+	// PositionDone.
+	OnPage func(key, position string)
+
+	// prefetched holds the details of pull requests retrieved by a
+	// GraphQL query
+	prefetched map[PRKey]*prefetchedPR
+	mu         sync.Mutex
+
+	// selected counts the pull requests passed to the callback, for
+	// the Limit of the Selection
+	selected int
+
+	// listing tells handlePage to collect the pull requests in
+	// listed, to draw a sample from, instead of processing them
+	listing bool
+	listed  []*github.PullRequest
 }
 
 const pageSize int = 50
 
+// PositionDone is the position of a listing of pull requests that
+// has been finished
+const PositionDone = "done"
+
+// lowRateLimit is the number of remaining API calls below which
+// pull requests are processed one at a time, no matter what
+// Concurrency is set to.
+const lowRateLimit int = 500
+
 // PRCallback is a type for callbacks for processing pull requests
 type PRCallback func(context.Context, *github.PullRequest) error
 
-// IteratePullRequests queries for all pull requests and invokes the
-// callback with each PR individually
+// IteratePullRequests queries for all pull requests in each of the
+// repositories and invokes the callback with each PR individually
 func (q *PullRequestQuery) IteratePullRequests(ctx context.Context, callback PRCallback) error {
+	q.selected = 0
+	if q.Selection != nil {
+		q.Progress.Cap(q.Selection.Limit)
+	}
+	if q.Selection != nil && q.Selection.Sample != nil {
+		return q.iterateSample(ctx, callback)
+	}
+
+	for _, repo := range q.Repos {
+		more, err := q.iterateRepo(ctx, repo, callback)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+	}
+
+	q.Progress.Finish()
+
+	return nil
+}
+
+// iterateSample lists the pull requests in all of the repositories,
+// draws the sample, and invokes the callback for the pull requests in
+// it. The details are fetched with the REST API, because listing the
+// pull requests with the GraphQL API would also fetch the details of
+// the ones left out of the sample.
+func (q *PullRequestQuery) iterateSample(ctx context.Context, callback PRCallback) error {
+	q.listing = true
+	q.listed = []*github.PullRequest{}
+	defer func() {
+		q.listing = false
+		q.listed = nil
+	}()
+
+	q.Log.Info("listing pull requests to sample")
+	for _, repo := range q.Repos {
+		more, err := q.iterateRepo(ctx, repo, callback)
+		if err != nil || !more {
+			return err
+		}
+	}
+
+	sample := q.Selection.Select(q.listed)
+	q.listing = false
+	q.Log.Info("drew sample", "method", q.Selection.Sample.Method,
+		"size", q.Selection.Sample.Drawn, "population", q.Selection.Sample.Population,
+		"seed", q.Selection.Sample.Seed)
+	if q.Log.Enabled(logging.LevelDebug) {
+		inSample := map[PRKey]bool{}
+		for _, pr := range sample {
+			inSample[KeyFor(pr)] = true
+		}
+		for _, pr := range q.listed {
+			if !inSample[KeyFor(pr)] {
+				q.Log.Debug("leaving out pull request not in the sample", "pr", KeyFor(pr))
+			}
+		}
+	}
+	q.Progress.Expect("sample", len(sample))
+	for start := 0; start < len(sample); start += pageSize {
+		end := start + pageSize
+		if end > len(sample) {
+			end = len(sample)
+		}
+		if more, err := q.processPage(ctx, sample[start:end], callback); !more {
+			return err
+		}
+	}
+
+	q.Progress.Finish()
+
+	return nil
+}
+
+// iterateRepo invokes the callback for the pull requests in one
+// repository. It returns false if the iteration should stop early.
+func (q *PullRequestQuery) iterateRepo(ctx context.Context, repo string, callback PRCallback) (bool, error) {
+	states := []string{"all"}
+	if !q.Since.IsZero() {
+		// Open pull requests are always included, but closed pull
+		// requests can be listed newest update first so we can stop
+		// when we reach the ones updated before Since.
+		states = []string{"open", "closed"}
+	}
+
+	for _, state := range states {
+		var (
+			more bool
+			err  error
+		)
+		switch {
+		case q.GraphQL && !q.listing:
+			more, err = q.iterateGraphQL(ctx, repo, state, callback)
+		case q.Search && state == "closed":
+			more, err = q.iterateSearch(ctx, repo, q.Since, time.Now(), true, callback)
+		default:
+			more, err = q.iterateList(ctx, repo, state, callback)
+		}
+		if err != nil || !more {
+			return more, err
+		}
+	}
+
+	return true, nil
+}
 
+// iterateList invokes the callback for the pull requests in the given
+// state returned by the list API. It returns false if the iteration
+// should stop early.
+func (q *PullRequestQuery) iterateList(ctx context.Context, repo, state string, callback PRCallback) (bool, error) {
 	opts := &github.PullRequestListOptions{
-		State: "all",
+		State: state,
 		ListOptions: github.ListOptions{
 			PerPage: pageSize,
 		},
 	}
+	if state == "closed" {
+		opts.Sort = "updated"
+		opts.Direction = "desc"
+	}
+
+	position, finished := q.resumeFrom(repo, state)
+	if finished {
+		return true, nil
+	}
+	if position != "" {
+		page, err := strconv.Atoi(position)
+		if err != nil {
+			return false, fmt.Errorf("invalid position %q to resume listing %s/%s", position, q.Org, repo)
+		}
+		opts.Page = page
+	}
+
+	// Pages skipped when resuming are counted as listed, because
+	// the pull requests on them are counted as processed.
+	listed := 0
+	if opts.Page > 1 {
+		listed = (opts.Page - 1) * pageSize
+	}
 
-	// Fetch the details of the pull requests in batches. We do not
-	// invoke the callback as a goroutine because it is likely to make
-	// other API calls and we want to limit the number of simultaneous
-	// requests we make to the API to avoid rate limiting.
+	// Fetch the details of the pull requests in batches. The
+	// callback is likely to make other API calls, so the number of
+	// pull requests processed at the same time is limited to avoid
+	// rate limiting.
 	for {
-		prs, response, err := q.Client.PullRequests.List(ctx, q.Org, q.Repo, opts)
+		prs, response, err := q.Client.PullRequests.List(ctx, q.Org, repo, opts)
 		if err != nil {
-			return errors.Wrap(err,
+			return false, errors.Wrap(err,
 				fmt.Sprintf(
-					"could not get pull requests for %s/%s", q.Org, q.Repo))
+					"could not get pull requests for %s/%s", q.Org, repo))
 		}
-		for _, pr := range prs {
-			err := callback(ctx, pr)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "\ncould not process pull request %s: %s\n",
-					*pr.HTMLURL, err)
-				continue
-			}
+		done := false
+		if state == "closed" {
+			prs, done = q.updatedSince(prs)
+		} else if len(prs) > 0 && q.Selection.belowRange(prs[len(prs)-1]) {
+			// The other listings are sorted with the newest pull
+			// requests first, so the rest are below the range too.
+			done = true
+		}
+		listed += len(prs)
+		q.expect(repo, state, listed, response.LastPage*pageSize, prs,
+			done || response.NextPage == 0)
+		page := opts.Page
+		if page == 0 {
+			page = 1
+		}
+		q.logPage(repo, state, "page", page, prs, done)
+		if more, err := q.handlePage(ctx, prs, callback); !more {
+			return false, err
+		}
+
+		if done || response.NextPage == 0 {
+			q.reachedPage(repo, state, PositionDone)
+			return true, nil
+		}
+		q.reachedPage(repo, state, strconv.Itoa(response.NextPage))
+		opts.Page = response.NextPage
+	}
+}
+
+// logPage records a page of a listing, and whether the listing is
+// stopping early because it reached pull requests updated before
+// Since or numbered below the Range
+func (q *PullRequestQuery) logPage(repo, state, positionName string, position interface{}, prs []*github.PullRequest, done bool) {
+	q.Log.Debug("listed pull requests", "repo", repo, "state", state,
+		positionName, position, "count", len(prs))
+	if !done {
+		return
+	}
+	fields := []interface{}{"repo", repo, "state", state}
+	if !q.Since.IsZero() {
+		fields = append(fields, "since", q.Since)
+	}
+	if q.Selection != nil && q.Selection.Range != nil {
+		fields = append(fields, "range", q.Selection.Range)
+	}
+	q.Log.Debug("stopping listing before the last page", fields...)
+}
 
-			select {
-			case <-ctx.Done():
-				fmt.Fprintf(os.Stderr, "stopping\n")
-				return nil
-			default:
+// expect tells Progress how many pull requests a listing is expected
+// to produce, from the number listed so far, including prs, and the
+// most it can produce, or zero if that is not known. A listing of
+// closed pull requests usually stops at the first one updated before
+// Since long before its last page, so until it is finished the
+// number listed is scaled up by how much of the time since Since it
+// has covered.
+func (q *PullRequestQuery) expect(repo, state string, listed, most int, prs []*github.PullRequest, finished bool) {
+	if q.Progress == nil || q.listing {
+		return
+	}
+	estimate := most
+	switch {
+	case finished:
+		estimate = listed
+	case state == "closed" && !q.Since.IsZero() && len(prs) > 0 && prs[len(prs)-1].UpdatedAt != nil:
+		covered := time.Since(*prs[len(prs)-1].UpdatedAt)
+		if covered > 0 {
+			scaled := int(float64(listed) * float64(time.Since(q.Since)) / float64(covered))
+			if most == 0 || scaled < most {
+				estimate = scaled
 			}
+		}
+	}
+	if estimate < listed {
+		estimate = listed
+	}
+	q.Progress.Expect(positionKey(repo, state), estimate)
+}
+
+// positionKey identifies a listing of the pull requests of a
+// repository in a state
+func positionKey(repo, state string) string {
+	return repo + "/" + state
+}
 
-			fmt.Fprintf(os.Stderr, ".")
+// resumeFrom returns the position to start listing from, and
+// whether the listing has already been finished
+func (q *PullRequestQuery) resumeFrom(repo, state string) (string, bool) {
+	if q.Selection.restartsListing() {
+		return "", false
+	}
+	position := q.Resume[positionKey(repo, state)]
+	if position != PositionDone && !resumesByPage(state) {
+		return "", false
+	}
+	return position, position == PositionDone
+}
+
+// resumesByPage returns true if a listing of the pull requests in
+// the state can continue from a page it reached before. Listings
+// sorted by creation only shift when pull requests are opened, so
+// at worst a few are seen twice. Closed pull requests are sorted by
+// update time, so the ones updated since would be missed.
+func resumesByPage(state string) bool {
+	return state != "closed"
+}
+
+// reachedPage tells OnPage about the position to continue from
+func (q *PullRequestQuery) reachedPage(repo, state, position string) {
+	if position != PositionDone && !resumesByPage(state) {
+		return
+	}
+	if q.OnPage != nil && !q.Selection.restartsListing() {
+		q.OnPage(positionKey(repo, state), position)
+	}
+}
+
+// updatedSince takes a list of pull requests sorted with the most
+// recently updated first and returns the ones updated on or after
+// Since, and whether any older pull requests were found.
+func (q *PullRequestQuery) updatedSince(prs []*github.PullRequest) ([]*github.PullRequest, bool) {
+	for i, pr := range prs {
+		if pr.UpdatedAt != nil && pr.UpdatedAt.Before(q.Since) {
+			return prs[:i], true
 		}
+	}
+	return prs, false
+}
 
-		if q.DevMode {
-			fmt.Fprintf(os.Stderr, "shortcutting for dev mode\n")
-			break
+// handlePage selects the pull requests to include from a page of a
+// listing and processes them, or collects them to draw a sample from.
+// It returns false if the iteration should stop, because the context
+// is cancelled, a callback fails, or the Limit has been reached.
+func (q *PullRequestQuery) handlePage(ctx context.Context, prs []*github.PullRequest, callback PRCallback) (bool, error) {
+	selected := []*github.PullRequest{}
+	for _, pr := range prs {
+		if q.Selection.Includes(pr) {
+			selected = append(selected, pr)
+			continue
 		}
+		q.Log.Debug("leaving out pull request outside the range", "pr", KeyFor(pr),
+			"range", q.Selection.Range)
+	}
 
-		if response.NextPage == 0 {
+	if q.listing {
+		q.listed = append(q.listed, selected...)
+		return ctx.Err() == nil, nil
+	}
+
+	more := true
+	if q.Selection != nil && q.Selection.Limit > 0 {
+		if remaining := q.Selection.Limit - q.selected; len(selected) >= remaining {
+			for _, pr := range selected[remaining:] {
+				q.Log.Debug("leaving out pull request past the limit", "pr", KeyFor(pr),
+					"limit", q.Selection.Limit)
+			}
+			selected = selected[:remaining]
+			more = false
+		}
+		q.selected += len(selected)
+	}
+
+	processed, err := q.processPage(ctx, selected, callback)
+	return processed && more, err
+}
+
+// processPage invokes the callback for each of the pull requests,
+// running up to Concurrency callbacks at a time, and waits for them
+// to finish. Errors from the callback are logged and the pull request
+// is skipped. It returns false if the context is cancelled or a
+// callback returns a StopError, along with the error. Use Failures to
+// keep track of the pull requests that cannot be processed.
+func (q *PullRequestQuery) processPage(ctx context.Context, prs []*github.PullRequest, callback PRCallback) (bool, error) {
+	sem := make(chan struct{}, q.workers(ctx))
+	var wg sync.WaitGroup
+
+	var mu sync.Mutex
+	var firstErr error
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	stopped := func() bool {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			q.Log.Info("stopping, the run was interrupted")
+			return true
+		default:
+			return false
+		}
+	}
+
+	for _, pr := range prs {
+		if stopped() {
+			return false, nil
+		}
+		if failed() {
 			break
 		}
-		opts.Page = response.NextPage
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(pr *github.PullRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := callback(ctx, pr)
+			if stop := asStop(err); stop != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				if firstErr == nil {
+					firstErr = errors.Wrap(stop.Err,
+						fmt.Sprintf("could not process pull request %s", pr.GetHTMLURL()))
+				}
+				return
+			}
+			if err != nil && !isLeftOut(err) {
+				q.Log.Warn("could not process pull request", "pr", KeyFor(pr), "err", err)
+			}
+			q.Progress.Done()
+		}(pr)
 	}
+	wg.Wait()
 
-	fmt.Fprintf(os.Stderr, "\n")
+	if firstErr != nil {
+		return false, firstErr
+	}
+	return !stopped(), nil
+}
 
-	return nil
+// workers returns the number of callbacks to run at the same time,
+// throttling back to 1 when the remaining rate limit is low.
+func (q *PullRequestQuery) workers(ctx context.Context) int {
+	if q.Concurrency <= 1 {
+		return 1
+	}
+	// Checking the rate limit does not count against it.
+	limits, _, err := q.Client.RateLimits(ctx)
+	if err != nil || limits.Core == nil {
+		return q.Concurrency
+	}
+	if limits.Core.Remaining < lowRateLimit {
+		q.Log.Warn("rate limit low, processing one pull request at a time",
+			"remaining", limits.Core.Remaining)
+		return 1
+	}
+	return q.Concurrency
+}
+
+// Repositories returns the names of the repositories being queried
+func (q *PullRequestQuery) Repositories() []string {
+	return q.Repos
+}
+
+func (q *PullRequestQuery) GetPullRequest(ctx context.Context, repo string, number int) (*github.PullRequest, error) {
+	pr, _, err := q.Client.PullRequests.Get(ctx, q.Org, repo, number)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			fmt.Sprintf("could not get pull request %s/%s#%d", q.Org, repo, number))
+	}
+	return pr, nil
 }
 
 func (q *PullRequestQuery) GetIssueComments(ctx context.Context, pr *github.PullRequest) ([]*github.IssueComment, error) {
+	if p := q.getPrefetched(pr); p != nil && p.issueComments != nil {
+		return p.issueComments, nil
+	}
+
 	opts := &github.IssueListCommentsOptions{
 		ListOptions: github.ListOptions{
 			PerPage: pageSize,
@@ -88,7 +534,7 @@ func (q *PullRequestQuery) GetIssueComments(ctx context.Context, pr *github.Pull
 
 	for {
 		comments, response, err := q.Client.Issues.ListComments(
-			ctx, q.Org, q.Repo, *pr.Number, opts)
+			ctx, q.Org, RepoName(pr), *pr.Number, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -103,6 +549,10 @@ func (q *PullRequestQuery) GetIssueComments(ctx context.Context, pr *github.Pull
 }
 
 func (q *PullRequestQuery) GetPRComments(ctx context.Context, pr *github.PullRequest) ([]*github.PullRequestComment, error) {
+	if p := q.getPrefetched(pr); p != nil && p.prComments != nil {
+		return p.prComments, nil
+	}
+
 	opts := &github.PullRequestListCommentsOptions{
 		ListOptions: github.ListOptions{
 			PerPage: pageSize,
@@ -112,7 +562,7 @@ func (q *PullRequestQuery) GetPRComments(ctx context.Context, pr *github.PullReq
 
 	for {
 		comments, response, err := q.Client.PullRequests.ListComments(
-			ctx, q.Org, q.Repo, *pr.Number, opts)
+			ctx, q.Org, RepoName(pr), *pr.Number, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -133,6 +583,10 @@ func (q *PullRequestQuery) GetPRComments(ctx context.Context, pr *github.PullReq
 }
 
 func (q *PullRequestQuery) GetReviews(ctx context.Context, pr *github.PullRequest) ([]*github.PullRequestReview, error) {
+	if p := q.getPrefetched(pr); p != nil && p.reviews != nil {
+		return p.reviews, nil
+	}
+
 	opts := &github.ListOptions{
 		PerPage: pageSize,
 	}
@@ -140,7 +594,7 @@ func (q *PullRequestQuery) GetReviews(ctx context.Context, pr *github.PullReques
 
 	for {
 		comments, response, err := q.Client.PullRequests.ListReviews(
-			ctx, q.Org, q.Repo, *pr.Number, opts)
+			ctx, q.Org, RepoName(pr), *pr.Number, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -161,6 +615,10 @@ func (q *PullRequestQuery) GetReviews(ctx context.Context, pr *github.PullReques
 }
 
 func (q *PullRequestQuery) GetCommits(ctx context.Context, pr *github.PullRequest) ([]*github.RepositoryCommit, error) {
+	if p := q.getPrefetched(pr); p != nil && p.commits != nil {
+		return p.commits, nil
+	}
+
 	opts := &github.ListOptions{
 		PerPage: pageSize,
 	}
@@ -168,7 +626,7 @@ func (q *PullRequestQuery) GetCommits(ctx context.Context, pr *github.PullReques
 
 	for {
 		commits, response, err := q.Client.PullRequests.ListCommits(
-			ctx, q.Org, q.Repo, *pr.Number, opts)
+			ctx, q.Org, RepoName(pr), *pr.Number, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -188,7 +646,44 @@ func (q *PullRequestQuery) GetCommits(ctx context.Context, pr *github.PullReques
 	return results, nil
 }
 
+// GetTimeline returns the events in the timeline of the pull
+// request, such as review requests, label changes, and force pushes
+func (q *PullRequestQuery) GetTimeline(ctx context.Context, pr *github.PullRequest) ([]*github.Timeline, error) {
+	if p := q.getPrefetched(pr); p != nil && p.timeline != nil {
+		return p.timeline, nil
+	}
+
+	opts := &github.ListOptions{
+		PerPage: pageSize,
+	}
+	results := []*github.Timeline{}
+
+	for {
+		events, response, err := q.Client.Issues.ListIssueTimeline(
+			ctx, q.Org, RepoName(pr), *pr.Number, opts)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, events...)
+		if response.NextPage == 0 {
+			break
+		}
+		opts.Page = response.NextPage
+
+		select {
+		case <-ctx.Done():
+			return results, nil
+		default:
+		}
+	}
+
+	return results, nil
+}
+
 func (q *PullRequestQuery) IsMerged(ctx context.Context, pr *github.PullRequest) (bool, error) {
-	isMerged, _, err := q.Client.PullRequests.IsMerged(ctx, q.Org, q.Repo, *pr.Number)
+	if p := q.getPrefetched(pr); p != nil {
+		return p.merged, nil
+	}
+	isMerged, _, err := q.Client.PullRequests.IsMerged(ctx, q.Org, RepoName(pr), *pr.Number)
 	return isMerged, err
 }
@@ -0,0 +1,249 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient returns a client that talks to a server using
+// handler in place of the GitHub API
+func newTestClient(t *testing.T, handler http.HandlerFunc) *github.Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+func TestIterateConcurrently(t *testing.T) {
+	remaining := 5000
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rate_limit":
+			fmt.Fprintf(w, `{"resources": {"core": {"limit": 5000, "remaining": %d}}}`, remaining)
+		case "/repos/o/r/pulls":
+			w.Write([]byte(`[
+				{"number": 6, "html_url": "u6"},
+				{"number": 5, "html_url": "u5"},
+				{"number": 4, "html_url": "u4"},
+				{"number": 3, "html_url": "u3"},
+				{"number": 2, "html_url": "u2"},
+				{"number": 1, "html_url": "u1"}
+			]`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	for _, tc := range []struct {
+		name      string
+		remaining int
+		want      int
+	}{
+		{"plenty of rate limit", 5000, 4},
+		{"low rate limit", 10, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			remaining = tc.remaining
+			q := &PullRequestQuery{Org: "o", Repos: []string{"r"}, Client: client, Concurrency: 4}
+
+			// Each callback waits for the others to start, up to the
+			// Concurrency, so the most running at once shows how
+			// many workers there were.
+			var mu sync.Mutex
+			running, most := 0, 0
+			allStarted := make(chan struct{})
+			var release sync.Once
+			seen := map[int]bool{}
+			err := q.IteratePullRequests(context.Background(), func(ctx context.Context, pr *github.PullRequest) error {
+				mu.Lock()
+				running++
+				if running > most {
+					most = running
+				}
+				if running == q.Concurrency {
+					release.Do(func() { close(allStarted) })
+				}
+				mu.Unlock()
+
+				select {
+				case <-allStarted:
+				case <-time.After(50 * time.Millisecond):
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				running--
+				seen[*pr.Number] = true
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, most)
+			assert.Equal(t, map[int]bool{1: true, 2: true, 3: true, 4: true, 5: true, 6: true}, seen)
+		})
+	}
+}
+
+func TestIterateSince(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("state") {
+		case "open":
+			w.Write([]byte(`[{"number": 5, "html_url": "u5", "updated_at": "2021-01-01T00:00:00Z"}]`))
+		case "closed":
+			assert.Equal(t, "updated", r.URL.Query().Get("sort"))
+			if r.URL.Query().Get("page") != "" {
+				t.Error("listed closed pull requests past the start date")
+			}
+			w.Header().Set("Link", `<`+r.URL.Path+`?state=closed&page=2>; rel="next"`)
+			w.Write([]byte(`[
+				{"number": 4, "html_url": "u4", "updated_at": "2022-03-01T00:00:00Z"},
+				{"number": 3, "html_url": "u3", "updated_at": "2022-01-01T00:00:00Z"}
+			]`))
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+		}
+	})
+
+	q := &PullRequestQuery{
+		Org:    "o",
+		Repos:  []string{"r"},
+		Client: client,
+		Since:  time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC),
+	}
+	seen := []int{}
+	err := q.IteratePullRequests(context.Background(), func(ctx context.Context, pr *github.PullRequest) error {
+		seen = append(seen, *pr.Number)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{5, 4}, seen)
+}
+
+func TestIterateResume(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "2":
+			w.Header().Set("Link", `<`+r.URL.Path+`?page=3>; rel="next"`)
+			w.Write([]byte(`[{"number": 2, "html_url": "u2"}]`))
+		case "3":
+			w.Write([]byte(`[{"number": 1, "html_url": "u1"}]`))
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+		}
+	})
+
+	positions := map[string]string{}
+	q := &PullRequestQuery{
+		Org:    "o",
+		Repos:  []string{"r", "s"},
+		Client: client,
+		Resume: map[string]string{"r/all": "2", "s/all": PositionDone},
+		OnPage: func(key, position string) {
+			positions[key] = position
+		},
+	}
+	seen := []int{}
+	err := q.IteratePullRequests(context.Background(), func(ctx context.Context, pr *github.PullRequest) error {
+		seen = append(seen, *pr.Number)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 1}, seen)
+	assert.Equal(t, map[string]string{"r/all": PositionDone}, positions)
+}
+
+func TestIterateResumeClosed(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("state") != "closed" || r.URL.Query().Get("page") != "" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Header().Set("Link", `<`+r.URL.Path+`?state=closed&page=2>; rel="next"`)
+		w.Write([]byte(`[
+			{"number": 3, "html_url": "u3", "updated_at": "2022-03-01T00:00:00Z"},
+			{"number": 2, "html_url": "u2", "updated_at": "2022-01-01T00:00:00Z"}
+		]`))
+	})
+
+	// The closed listing starts over, since the pull requests
+	// updated after the interruption are on its first page.
+	positions := map[string]string{}
+	q := &PullRequestQuery{
+		Org:    "o",
+		Repos:  []string{"r"},
+		Client: client,
+		Since:  time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC),
+		Resume: map[string]string{"r/open": PositionDone, "r/closed": "4"},
+		OnPage: func(key, position string) {
+			positions[key] = position
+		},
+	}
+	seen := []int{}
+	err := q.IteratePullRequests(context.Background(), func(ctx context.Context, pr *github.PullRequest) error {
+		seen = append(seen, *pr.Number)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{3}, seen)
+	assert.Equal(t, map[string]string{"r/closed": PositionDone}, positions)
+}
+
+func TestIterateSelection(t *testing.T) {
+	requests := 0
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", `<`+r.URL.Path+`?page=2>; rel="next"`)
+			w.Write([]byte(`[{"number": 5, "html_url": "u5"}, {"number": 4, "html_url": "u4"}, {"number": 3, "html_url": "u3"}]`))
+		case "2":
+			w.Write([]byte(`[{"number": 2, "html_url": "u2"}, {"number": 1, "html_url": "u1"}]`))
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+		}
+	})
+
+	iterate := func(selection *Selection, resume map[string]string) []int {
+		q := &PullRequestQuery{
+			Org:       "o",
+			Repos:     []string{"r"},
+			Client:    client,
+			Selection: selection,
+			Resume:    resume,
+		}
+		seen := []int{}
+		err := q.IteratePullRequests(context.Background(), func(ctx context.Context, pr *github.PullRequest) error {
+			seen = append(seen, *pr.Number)
+			return nil
+		})
+		require.NoError(t, err)
+		return seen
+	}
+
+	// The limit starts from the beginning, not the resume position,
+	// and stops without fetching the next page.
+	assert.Equal(t, []int{5, 4}, iterate(&Selection{Limit: 2}, map[string]string{"r/all": "2"}))
+	assert.Equal(t, 1, requests)
+
+	// The listing stops once it is below the range.
+	requests = 0
+	assert.Equal(t, []int{5, 4}, iterate(&Selection{Range: &NumberRange{First: 4, Last: 9}}, nil))
+	assert.Equal(t, 1, requests)
+
+	requests = 0
+	sample := &Sample{Method: SampleRandom, Size: 3, Seed: 1}
+	seen := iterate(&Selection{Sample: sample}, nil)
+	assert.Equal(t, 3, len(seen))
+	assert.Equal(t, 5, sample.Population)
+	assert.Equal(t, 3, sample.Drawn)
+	assert.Equal(t, 2, requests)
+}
@@ -0,0 +1,198 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/pkg/errors"
+)
+
+// PRKey identifies a pull request across all of the repositories in
+// a query
+type PRKey struct {
+	Repo   string
+	Number int
+}
+
+func (k PRKey) String() string {
+	return fmt.Sprintf("%s#%d", k.Repo, k.Number)
+}
+
+// KeyFor returns the key for a pull request
+func KeyFor(pr *github.PullRequest) PRKey {
+	return PRKey{Repo: RepoName(pr), Number: pr.GetNumber()}
+}
+
+// RepoName returns the name of the repository a pull request belongs
+// to, without the organization
+func RepoName(pr *github.PullRequest) string {
+	if name := pr.GetBase().GetRepo().GetName(); name != "" {
+		return name
+	}
+	// The URL looks like https://github.com/org/repo/pull/123
+	u, err := url.Parse(pr.GetHTMLURL())
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 4 {
+		return ""
+	}
+	return parts[len(parts)-3]
+}
+
+// RepositoryFilter describes which repositories of an organization
+// to include in a report
+type RepositoryFilter struct {
+	// Patterns are repository names or glob patterns. All
+	// repositories match when there are no patterns.
+	Patterns []string
+
+	// Topics, if given, limits the repositories to those with at
+	// least one of the topics.
+	Topics []string
+
+	// ExcludeTopics removes repositories with any of the topics.
+	ExcludeTopics []string
+}
+
+// needsListing reports whether the repositories have to be listed to
+// apply the filter, or if the patterns can be used as names directly
+func (f *RepositoryFilter) needsListing() bool {
+	if len(f.Patterns) == 0 || len(f.Topics) > 0 || len(f.ExcludeTopics) > 0 {
+		return true
+	}
+	for _, p := range f.Patterns {
+		if strings.ContainsAny(p, "*?[") {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *RepositoryFilter) match(repo *github.Repository) bool {
+	name := repo.GetName()
+
+	matched := len(f.Patterns) == 0
+	literal := false
+	for _, p := range f.Patterns {
+		if p == name {
+			matched = true
+			literal = true
+			break
+		}
+		if ok, _ := path.Match(p, name); ok {
+			matched = true
+		}
+	}
+	if !matched {
+		return false
+	}
+
+	// Archived repositories are only included when they are named
+	// explicitly.
+	if repo.GetArchived() && !literal {
+		return false
+	}
+
+	hasTopic := func(topics []string) bool {
+		for _, want := range topics {
+			for _, have := range repo.Topics {
+				if want == have {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if len(f.Topics) > 0 && !hasTopic(f.Topics) {
+		return false
+	}
+	return !hasTopic(f.ExcludeTopics)
+}
+
+// MatchNames returns the names that match the Patterns, for sources
+// that only know the names of their repositories. The Topics are not
+// checked.
+func (f *RepositoryFilter) MatchNames(names []string) []string {
+	matched := []string{}
+	for _, name := range names {
+		if (&RepositoryFilter{Patterns: f.Patterns}).match(&github.Repository{Name: github.String(name)}) {
+			matched = append(matched, name)
+		}
+	}
+	return matched
+}
+
+// ListRepositories returns the sorted names of the repositories owned
+// by org that match the filter.
+func ListRepositories(ctx context.Context, client *github.Client, org string, filter RepositoryFilter) ([]string, error) {
+	if !filter.needsListing() {
+		return filter.Patterns, nil
+	}
+
+	names := []string{}
+	opts := &github.RepositoryListByOrgOptions{
+		ListOptions: github.ListOptions{
+			PerPage: pageSize,
+		},
+	}
+	for {
+		repos, response, err := client.Repositories.ListByOrg(ctx, org, opts)
+		if err != nil {
+			// The owner may be a user instead of an organization.
+			if response != nil && response.StatusCode == http.StatusNotFound {
+				return listUserRepositories(ctx, client, org, filter)
+			}
+			return nil, errors.Wrap(err,
+				fmt.Sprintf("could not list repositories for %s", org))
+		}
+		for _, repo := range repos {
+			if filter.match(repo) {
+				names = append(names, repo.GetName())
+			}
+		}
+		if response.NextPage == 0 {
+			break
+		}
+		opts.Page = response.NextPage
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+func listUserRepositories(ctx context.Context, client *github.Client, user string, filter RepositoryFilter) ([]string, error) {
+	names := []string{}
+	opts := &github.RepositoryListOptions{
+		Type: "owner",
+		ListOptions: github.ListOptions{
+			PerPage: pageSize,
+		},
+	}
+	for {
+		repos, response, err := client.Repositories.List(ctx, user, opts)
+		if err != nil {
+			return nil, errors.Wrap(err,
+				fmt.Sprintf("could not list repositories for %s", user))
+		}
+		for _, repo := range repos {
+			if filter.match(repo) {
+				names = append(names, repo.GetName())
+			}
+		}
+		if response.NextPage == 0 {
+			break
+		}
+		opts.Page = response.NextPage
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
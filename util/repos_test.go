@@ -0,0 +1,64 @@
+package util
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoName(t *testing.T) {
+	withBase := &github.PullRequest{
+		Base: &github.PullRequestBranch{Repo: &github.Repository{Name: github.String("a")}},
+	}
+	assert.Equal(t, "a", RepoName(withBase))
+
+	withURL := &github.PullRequest{HTMLURL: github.String("https://github.com/o/b/pull/12")}
+	assert.Equal(t, "b", RepoName(withURL))
+	assert.Equal(t, PRKey{Repo: "b", Number: 0}, KeyFor(withURL))
+}
+
+func TestListRepositories(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/orgs/o/repos":
+			w.Write([]byte(`[
+				{"name": "api", "topics": ["go"]},
+				{"name": "api-docs", "topics": ["docs"]},
+				{"name": "api-old", "archived": true, "topics": ["go"]},
+				{"name": "website", "topics": ["go", "docs"]}
+			]`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name     string
+		filter   RepositoryFilter
+		expected []string
+	}{
+		{"names", RepositoryFilter{Patterns: []string{"b", "a"}}, []string{"b", "a"}},
+		{"all", RepositoryFilter{}, []string{"api", "api-docs", "website"}},
+		{"glob", RepositoryFilter{Patterns: []string{"api*"}}, []string{"api", "api-docs"}},
+		{"archived", RepositoryFilter{Patterns: []string{"api*", "api-old"}}, []string{"api", "api-docs", "api-old"}},
+		{"topic", RepositoryFilter{Topics: []string{"go"}}, []string{"api", "website"}},
+		{"exclude", RepositoryFilter{Topics: []string{"go"}, ExcludeTopics: []string{"docs"}}, []string{"api"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			names, err := ListRepositories(ctx, client, "o", tc.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, names)
+		})
+	}
+}
+
+func TestMatchNames(t *testing.T) {
+	filter := RepositoryFilter{Patterns: []string{"api*", "website"}}
+	assert.Equal(t, []string{"api", "api-docs", "website"},
+		filter.MatchNames([]string{"api", "api-docs", "tools", "website"}))
+}
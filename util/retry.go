@@ -0,0 +1,161 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhellmann/gh-review-stats/logging"
+)
+
+// maxRetries is the number of times a request is retried before the
+// last response is returned to the caller
+const maxRetries int = 5
+
+// initialBackoff and maxBackoff control the delay between retries of
+// requests that fail with a server error
+const (
+	initialBackoff = 2 * time.Second
+	maxBackoff     = time.Minute
+)
+
+// secondaryRateLimitWait is used when GitHub reports a secondary rate
+// limit without saying how long to wait
+const secondaryRateLimitWait = time.Minute
+
+// retryTransport is an http.RoundTripper that waits and retries
+// requests that fail because of rate limits or server errors.
+type retryTransport struct {
+	base http.RoundTripper
+
+	// log records the reasons for waiting
+	log *logging.Logger
+
+	// sleep waits for the delay or until the context is cancelled.
+	// It is replaced by the tests.
+	sleep func(context.Context, time.Duration) error
+	now   func() time.Time
+}
+
+func newRetryTransport(base http.RoundTripper) *retryTransport {
+	return &retryTransport{
+		base:  base,
+		sleep: sleepContext,
+		now:   time.Now,
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := initialBackoff
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		if attempt >= maxRetries {
+			return resp, nil
+		}
+
+		wait, reason := t.retryDelay(resp, &backoff)
+		if wait == 0 {
+			return resp, nil
+		}
+
+		// Discard the response we are not going to return so the
+		// connection can be reused.
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		t.log.Warn("waiting before retrying", "reason", reason,
+			"endpoint", req.URL.Path, "wait", wait.Round(time.Second))
+		if err := t.sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryDelay examines a response and returns how long to wait before
+// retrying the request, along with a description of the problem. A
+// delay of 0 means the response should be returned as it is.
+func (t *retryTransport) retryDelay(resp *http.Response, backoff *time.Duration) (time.Duration, string) {
+	switch {
+	case resp.StatusCode >= 500:
+		wait := *backoff
+		*backoff *= 2
+		if *backoff > maxBackoff {
+			*backoff = maxBackoff
+		}
+		return wait, fmt.Sprintf("server error %q", resp.Status)
+
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests:
+		if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+			if seconds, err := strconv.Atoi(retryAfter); err == nil {
+				return time.Duration(seconds) * time.Second, "secondary rate limit exceeded"
+			}
+		}
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			return t.untilReset(resp), "rate limit exceeded"
+		}
+		if bodyContains(resp, "secondary rate limit") {
+			return secondaryRateLimitWait, "secondary rate limit exceeded"
+		}
+
+	case resp.StatusCode == http.StatusOK:
+		// The GraphQL API reports running out of quota in the body
+		// of a successful response.
+		if resp.Request != nil && resp.Request.Method == http.MethodPost &&
+			resp.Header.Get("X-RateLimit-Remaining") == "0" &&
+			bodyContains(resp, "RATE_LIMITED") {
+			return t.untilReset(resp), "GraphQL rate limit exceeded"
+		}
+	}
+	return 0, ""
+}
+
+// untilReset returns the time until the rate limit in the response
+// is reset, with a little extra to allow for clock differences.
+func (t *retryTransport) untilReset(resp *http.Response) time.Duration {
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return secondaryRateLimitWait
+	}
+	wait := time.Unix(reset, 0).Sub(t.now()) + time.Second
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait
+}
+
+// bodyContains reports whether the response body includes text,
+// leaving the body in place to be read again.
+func bodyContains(resp *http.Response, text string) bool {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return err == nil && strings.Contains(string(body), text)
+}
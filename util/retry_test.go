@@ -0,0 +1,71 @@
+package util
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetry(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for name, tc := range map[string]struct {
+		fail     func(w http.ResponseWriter)
+		expected time.Duration
+	}{
+		"primary": {
+			fail: func(w http.ResponseWriter) {
+				w.Header().Set("X-RateLimit-Remaining", "0")
+				w.Header().Set("X-RateLimit-Reset",
+					strconv.FormatInt(now.Add(10*time.Minute).Unix(), 10))
+				w.WriteHeader(http.StatusForbidden)
+			},
+			expected: 10*time.Minute + time.Second,
+		},
+		"secondary": {
+			fail: func(w http.ResponseWriter) {
+				w.Header().Set("Retry-After", "30")
+				w.WriteHeader(http.StatusForbidden)
+			},
+			expected: 30 * time.Second,
+		},
+		"server error": {
+			fail: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusBadGateway)
+			},
+			expected: initialBackoff,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			requests := 0
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests == 1 {
+					tc.fail(w)
+					return
+				}
+				w.Write([]byte("ok"))
+			})
+
+			var waited time.Duration
+			transport := newRetryTransport(http.DefaultTransport)
+			transport.now = func() time.Time { return now }
+			transport.sleep = func(ctx context.Context, d time.Duration) error {
+				waited += d
+				return nil
+			}
+
+			resp, err := (&http.Client{Transport: transport}).Get(client.BaseURL.String())
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, 2, requests)
+			assert.Equal(t, tc.expected, waited)
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/pkg/errors"
+)
+
+// searchResultLimit is the largest number of results the search API
+// returns for one query
+const searchResultLimit int = 1000
+
+// iterateSearch invokes the callback for the closed pull requests
+// updated between start and end, found with the search API. When
+// there are more matches than the search API will return, the date
+// range is split in half and each half is searched separately. The
+// outermost search, with top set, tells Progress how many pull
+// requests to expect. It returns false if the iteration should stop
+// early.
+func (q *PullRequestQuery) iterateSearch(ctx context.Context, repo string, start, end time.Time, top bool, callback PRCallback) (bool, error) {
+	query := fmt.Sprintf("is:pr is:closed repo:%s/%s updated:%s..%s",
+		q.Org, repo,
+		start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339))
+	opts := &github.SearchOptions{
+		Sort:  "updated",
+		Order: "desc",
+		ListOptions: github.ListOptions{
+			PerPage: pageSize,
+		},
+	}
+
+	for {
+		result, response, err := q.Client.Search.Issues(ctx, query, opts)
+		if err != nil {
+			return false, errors.Wrap(err,
+				fmt.Sprintf(
+					"could not search pull requests for %s/%s", q.Org, repo))
+		}
+
+		if top && opts.Page == 0 {
+			q.expect(repo, "closed", 0, result.GetTotal(), nil, false)
+		}
+
+		// The range boundaries are inclusive, so the halves do not
+		// overlap if the older half ends a second before the
+		// newer half starts.
+		if opts.Page == 0 && result.GetTotal() > searchResultLimit {
+			if end.Sub(start) <= time.Second {
+				// The range cannot be split any further, so the
+				// search would lose the matches past the limit.
+				q.Log.Warn("too many pull requests updated at once for the search API, listing them instead",
+					"repo", repo, "start", start, "end", end, "count", result.GetTotal())
+				return q.iterateUpdatedBetween(ctx, repo, start, end, callback)
+			}
+			middle := start.Add(end.Sub(start) / 2).Truncate(time.Second)
+			more, err := q.iterateSearch(ctx, repo, middle.Add(time.Second), end, false, callback)
+			if err != nil || !more {
+				return more, err
+			}
+			return q.iterateSearch(ctx, repo, start, middle, false, callback)
+		}
+
+		prs := []*github.PullRequest{}
+		for _, issue := range result.Issues {
+			prs = append(prs, q.issueToPullRequest(repo, issue))
+		}
+		if more, err := q.handlePage(ctx, prs, callback); !more {
+			return false, err
+		}
+
+		if response.NextPage == 0 {
+			return true, nil
+		}
+		opts.Page = response.NextPage
+	}
+}
+
+// iterateUpdatedBetween invokes the callback for the closed pull
+// requests updated between start and end, inclusive, found by listing
+// the closed pull requests with the most recently updated first. It
+// is used for ranges too short to split that have more matches than
+// the search API will return. It returns false if the iteration
+// should stop early.
+func (q *PullRequestQuery) iterateUpdatedBetween(ctx context.Context, repo string, start, end time.Time, callback PRCallback) (bool, error) {
+	opts := &github.PullRequestListOptions{
+		State:     "closed",
+		Sort:      "updated",
+		Direction: "desc",
+		ListOptions: github.ListOptions{
+			PerPage: pageSize,
+			Page:    1,
+		},
+	}
+	// The range boundaries are whole seconds.
+	last := end.Add(time.Second)
+
+	for {
+		prs, response, err := q.Client.PullRequests.List(ctx, q.Org, repo, opts)
+		if err != nil {
+			return false, errors.Wrap(err,
+				fmt.Sprintf(
+					"could not get pull requests for %s/%s", q.Org, repo))
+		}
+		inRange := []*github.PullRequest{}
+		done := false
+		for _, pr := range prs {
+			updated := pr.GetUpdatedAt()
+			if !updated.Before(last) {
+				continue
+			}
+			if updated.Before(start) {
+				done = true
+				break
+			}
+			inRange = append(inRange, pr)
+		}
+		q.logPage(repo, "closed", "page", opts.Page, inRange, done)
+		if more, err := q.handlePage(ctx, inRange, callback); !more {
+			return false, err
+		}
+
+		if done || response.NextPage == 0 {
+			return true, nil
+		}
+		opts.Page = response.NextPage
+	}
+}
+
+// issueToPullRequest converts a search result to a pull request with
+// the fields the stats packages need. Everything else about the pull
+// request is fetched separately.
+func (q *PullRequestQuery) issueToPullRequest(repo string, issue *github.Issue) *github.PullRequest {
+	return &github.PullRequest{
+		ID:        issue.ID,
+		Number:    issue.Number,
+		Title:     issue.Title,
+		HTMLURL:   issue.HTMLURL,
+		State:     issue.State,
+		User:      issue.User,
+		Labels:    issue.Labels,
+		CreatedAt: issue.CreatedAt,
+		UpdatedAt: issue.UpdatedAt,
+		ClosedAt:  issue.ClosedAt,
+		Base: &github.PullRequestBranch{
+			Repo: &github.Repository{
+				Name:  github.String(repo),
+				Owner: &github.User{Login: github.String(q.Org)},
+			},
+		},
+	}
+}
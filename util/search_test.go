@@ -0,0 +1,91 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterateSearchSplitsRange(t *testing.T) {
+	since := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := since.Add(4 * 24 * time.Hour)
+
+	var mu sync.Mutex
+	queries := []string{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("q")
+		mu.Lock()
+		queries = append(queries, query)
+		mu.Unlock()
+
+		// Pretend every day has 600 pull requests, so only ranges
+		// of a day or less fit within the search limit.
+		var start, end time.Time
+		dates := strings.Split(strings.TrimPrefix(query[strings.Index(query, "updated:"):], "updated:"), "..")
+		start, _ = time.Parse(time.RFC3339, dates[0])
+		end, _ = time.Parse(time.RFC3339, dates[1])
+		total := 600
+		if end.Sub(start) > 24*time.Hour {
+			total = 2400
+		}
+		fmt.Fprintf(w, `{"total_count": %d, "items": [{"number": %d, "html_url": "u"}]}`,
+			total, start.Day())
+	})
+
+	q := &PullRequestQuery{Org: "o", Client: client, Progress: NewProgress(io.Discard)}
+	seen := []int{}
+	more, err := q.iterateSearch(context.Background(), "r", since, now, true,
+		func(ctx context.Context, pr *github.PullRequest) error {
+			seen = append(seen, *pr.Number)
+			return nil
+		})
+	require.NoError(t, err)
+	assert.True(t, more)
+	// The newest half of the range is searched first.
+	assert.Equal(t, []int{4, 3, 2, 1}, seen)
+	assert.Contains(t, queries[0], "is:pr is:closed repo:o/r")
+	// The total of the first search is the number expected.
+	assert.Equal(t, 2400, q.Progress.total())
+}
+
+func TestIterateSearchListsUnsplittableRange(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Second)
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/search/issues":
+			fmt.Fprintf(w, `{"total_count": 1500, "items": [{"number": 99, "html_url": "u"}]}`)
+		case "/repos/o/r/pulls":
+			assert.Equal(t, "updated", r.URL.Query().Get("sort"))
+			w.Write([]byte(`[
+				{"number": 4, "html_url": "u4", "updated_at": "2022-01-01T00:00:02Z"},
+				{"number": 3, "html_url": "u3", "updated_at": "2022-01-01T00:00:01Z"},
+				{"number": 2, "html_url": "u2", "updated_at": "2022-01-01T00:00:00Z"},
+				{"number": 1, "html_url": "u1", "updated_at": "2021-12-31T23:59:59Z"}
+			]`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	q := &PullRequestQuery{Org: "o", Client: client}
+	seen := []int{}
+	more, err := q.iterateSearch(context.Background(), "r", start, end, true,
+		func(ctx context.Context, pr *github.PullRequest) error {
+			seen = append(seen, *pr.Number)
+			return nil
+		})
+	require.NoError(t, err)
+	assert.True(t, more)
+	assert.Equal(t, []int{3, 2}, seen)
+}
@@ -0,0 +1,267 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/pkg/errors"
+)
+
+// The methods for drawing a sample of the pull requests
+const (
+	SampleRandom     = "random"
+	SampleStratified = "stratified"
+)
+
+// Selection limits the pull requests an iteration processes, so
+// huge repositories can be analysed from part of their history
+type Selection struct {
+	// Limit stops the iteration after this many pull requests. Zero
+	// means there is no limit.
+	Limit int
+
+	// Range, when set, only includes the pull requests numbered
+	// within it
+	Range *NumberRange
+
+	// Sample, when set, processes a sample of the pull requests
+	// instead of all of them
+	Sample *Sample
+}
+
+// NumberRange is an inclusive range of pull request numbers
+type NumberRange struct {
+	First int
+	Last  int
+}
+
+// ParseNumberRange parses a range of pull request numbers given as
+// first-last
+func ParseNumberRange(value string) (*NumberRange, error) {
+	parts := strings.SplitN(value, "-", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid range %q, expected first-last", value)
+	}
+	first, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("invalid start of range %q", value))
+	}
+	last, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("invalid end of range %q", value))
+	}
+	if first < 1 || last < first {
+		return nil, fmt.Errorf("invalid range %q, expected positive numbers with the first no larger than the last", value)
+	}
+	return &NumberRange{First: first, Last: last}, nil
+}
+
+// Contains reports whether the number is in the range
+func (r *NumberRange) Contains(number int) bool {
+	return number >= r.First && number <= r.Last
+}
+
+func (r *NumberRange) String() string {
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// Sample describes how to draw a sample of the pull requests
+type Sample struct {
+	// Method is SampleRandom or SampleStratified. A stratified
+	// sample takes the same share of the pull requests created in
+	// each repository in each month, so quiet repositories and busy
+	// months are represented in proportion.
+	Method string
+
+	// Size is the number of pull requests in the sample. When it is
+	// zero, Fraction of the pull requests are included instead.
+	Size     int
+	Fraction float64
+
+	// Seed initializes the random number generator, so the same
+	// sample can be drawn again
+	Seed int64
+
+	// Population and Drawn are set when the sample is drawn, to the
+	// number of pull requests the sample was drawn from and the
+	// number in the sample
+	Population int
+	Drawn      int
+}
+
+// ParseSample parses the size of a sample, given as a number of pull
+// requests or as a percentage of them
+func ParseSample(value, method string, seed int64) (*Sample, error) {
+	if method != SampleRandom && method != SampleStratified {
+		return nil, fmt.Errorf("unknown sample method %q, expected %q or %q",
+			method, SampleRandom, SampleStratified)
+	}
+	s := &Sample{Method: method, Seed: seed}
+	if percent := strings.TrimSuffix(value, "%"); percent != value {
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("invalid sample size %q, expected a percentage between 0 and 100", value)
+		}
+		s.Fraction = p / 100
+		return s, nil
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 1 {
+		return nil, fmt.Errorf("invalid sample size %q, expected a number of pull requests or a percentage", value)
+	}
+	s.Size = size
+	return s, nil
+}
+
+// String describes the sample for reports
+func (s *Sample) String() string {
+	return fmt.Sprintf("%s sample of %d of %d pull requests (seed %d)",
+		s.Method, s.Drawn, s.Population, s.Seed)
+}
+
+// size returns the number of pull requests to draw from the
+// population
+func (s *Sample) size(population int) int {
+	size := s.Size
+	if size == 0 {
+		size = int(math.Round(s.Fraction * float64(population)))
+		if size == 0 && population > 0 {
+			size = 1
+		}
+	}
+	if size > population {
+		size = population
+	}
+	return size
+}
+
+// draw returns a sample of the pull requests, keeping their order
+func (s *Sample) draw(prs []*github.PullRequest) []*github.PullRequest {
+	rng := rand.New(rand.NewSource(s.Seed))
+	size := s.size(len(prs))
+
+	var picked []int
+	if s.Method == SampleStratified {
+		picked = drawStratified(rng, prs, size)
+	} else {
+		picked = rng.Perm(len(prs))[:size]
+	}
+	sort.Ints(picked)
+
+	results := []*github.PullRequest{}
+	for _, i := range picked {
+		results = append(results, prs[i])
+	}
+	s.Population = len(prs)
+	s.Drawn = len(results)
+	return results
+}
+
+// stratum returns the group a pull request is sampled from in a
+// stratified sample
+func stratum(pr *github.PullRequest) string {
+	return fmt.Sprintf("%s %s", RepoName(pr), pr.GetCreatedAt().Format("2006-01"))
+}
+
+// drawStratified returns the indexes of a sample of the pull
+// requests taken from each stratum in proportion to its size. The
+// places left over from rounding down go to the strata with the
+// largest remainders.
+func drawStratified(rng *rand.Rand, prs []*github.PullRequest, size int) []int {
+	strata := map[string][]int{}
+	keys := []string{}
+	for i, pr := range prs {
+		key := stratum(pr)
+		if _, ok := strata[key]; !ok {
+			keys = append(keys, key)
+		}
+		strata[key] = append(strata[key], i)
+	}
+	sort.Strings(keys)
+
+	shares := map[string]int{}
+	remainders := map[string]float64{}
+	allocated := 0
+	for _, key := range keys {
+		exact := float64(size) * float64(len(strata[key])) / float64(len(prs))
+		shares[key] = int(math.Floor(exact))
+		remainders[key] = exact - math.Floor(exact)
+		allocated += shares[key]
+	}
+	byRemainder := append([]string{}, keys...)
+	sort.SliceStable(byRemainder, func(i, j int) bool {
+		return remainders[byRemainder[i]] > remainders[byRemainder[j]]
+	})
+	for _, key := range byRemainder[:size-allocated] {
+		shares[key]++
+	}
+
+	picked := []int{}
+	for _, key := range keys {
+		members := strata[key]
+		for _, i := range rng.Perm(len(members))[:shares[key]] {
+			picked = append(picked, members[i])
+		}
+	}
+	return picked
+}
+
+// Includes reports whether the pull request is within the Range
+func (s *Selection) Includes(pr *github.PullRequest) bool {
+	return s == nil || s.Range == nil || s.Range.Contains(pr.GetNumber())
+}
+
+// belowRange reports whether the pull request is numbered before the
+// Range, so a listing of the newest pull requests first can stop
+func (s *Selection) belowRange(pr *github.PullRequest) bool {
+	return s != nil && s.Range != nil && pr.GetNumber() < s.Range.First
+}
+
+// restartsListing reports whether the pull requests have to be
+// listed from the beginning for the selection to be the same, so
+// an interrupted listing cannot be resumed part way through
+func (s *Selection) restartsListing() bool {
+	return s != nil && (s.Limit > 0 || s.Sample != nil)
+}
+
+// Select returns the pull requests chosen from prs, keeping their
+// order. The Range is applied first, then the Sample is drawn, and
+// then the Limit is applied.
+func (s *Selection) Select(prs []*github.PullRequest) []*github.PullRequest {
+	if s == nil {
+		return prs
+	}
+	results := []*github.PullRequest{}
+	for _, pr := range prs {
+		if s.Includes(pr) {
+			results = append(results, pr)
+		}
+	}
+	if s.Sample != nil {
+		results = s.Sample.draw(results)
+	}
+	if s.Limit > 0 && len(results) > s.Limit {
+		results = results[:s.Limit]
+	}
+	return results
+}
+
+// Iterate invokes the callback for the pull requests chosen from
+// prs, stopping at the first error
+func (s *Selection) Iterate(ctx context.Context, prs []*github.PullRequest, callback PRCallback) error {
+	for _, pr := range s.Select(prs) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := callback(ctx, pr); err != nil && !isLeftOut(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package util
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNumberRange(t *testing.T) {
+	r, err := ParseNumberRange("100-250")
+	require.NoError(t, err)
+	assert.Equal(t, &NumberRange{First: 100, Last: 250}, r)
+	assert.True(t, r.Contains(100))
+	assert.True(t, r.Contains(250))
+	assert.False(t, r.Contains(251))
+
+	for _, value := range []string{"100", "a-2", "1-b", "250-100", "0-5"} {
+		_, err := ParseNumberRange(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParseSample(t *testing.T) {
+	s, err := ParseSample("500", SampleRandom, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 500, s.Size)
+
+	s, err = ParseSample("10%", SampleStratified, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 0.1, s.Fraction)
+	assert.Equal(t, 3, s.size(25))
+
+	for _, value := range []string{"0", "-1", "0%", "101%", "many"} {
+		_, err := ParseSample(value, SampleRandom, 1)
+		assert.Error(t, err, value)
+	}
+	_, err = ParseSample("5", "systematic", 1)
+	assert.Error(t, err)
+}
+
+func newSelectionPRs(repo string, months, perMonth int) []*github.PullRequest {
+	prs := []*github.PullRequest{}
+	for m := 0; m < months; m++ {
+		created := time.Date(2022, time.Month(m+1), 1, 0, 0, 0, 0, time.UTC)
+		for i := 0; i < perMonth; i++ {
+			number := m*perMonth + i + 1
+			prs = append(prs, &github.PullRequest{
+				Number:    github.Int(number),
+				HTMLURL:   github.String(fmt.Sprintf("https://github.com/o/%s/pull/%d", repo, number)),
+				CreatedAt: &created,
+			})
+		}
+	}
+	return prs
+}
+
+func TestSelect(t *testing.T) {
+	prs := newSelectionPRs("r", 1, 10)
+
+	var none *Selection
+	assert.Equal(t, prs, none.Select(prs))
+
+	selected := (&Selection{Range: &NumberRange{First: 3, Last: 8}, Limit: 2}).Select(prs)
+	assert.Equal(t, prs[2:4], selected)
+}
+
+func TestSampleRandom(t *testing.T) {
+	prs := newSelectionPRs("r", 1, 100)
+
+	draw := func(seed int64) []*github.PullRequest {
+		s := &Selection{Sample: &Sample{Method: SampleRandom, Size: 10, Seed: seed}}
+		return s.Select(prs)
+	}
+	first := draw(1)
+	require.Equal(t, 10, len(first))
+	assert.Equal(t, first, draw(1), "the same seed draws the same sample")
+	assert.NotEqual(t, first, draw(2))
+	for i := 1; i < len(first); i++ {
+		assert.Less(t, first[i-1].GetNumber(), first[i].GetNumber(), "the order is kept")
+	}
+}
+
+func TestSampleStratified(t *testing.T) {
+	// One repository has 3 months of 30 pull requests, and the
+	// other has 1 month of 10.
+	prs := append(newSelectionPRs("a", 3, 30), newSelectionPRs("b", 1, 10)...)
+
+	sample := &Sample{Method: SampleStratified, Fraction: 0.1, Seed: 1}
+	selected := (&Selection{Sample: sample}).Select(prs)
+	require.Equal(t, 10, len(selected))
+	assert.Equal(t, 100, sample.Population)
+	assert.Equal(t, 10, sample.Drawn)
+
+	counts := map[string]int{}
+	for _, pr := range selected {
+		counts[stratum(pr)]++
+	}
+	assert.Equal(t, map[string]int{
+		"a 2022-01": 3,
+		"a 2022-02": 3,
+		"a 2022-03": 3,
+		"b 2022-01": 1,
+	}, counts)
+}
@@ -0,0 +1,94 @@
+package util
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/pkg/errors"
+)
+
+// PullRequestSource provides pull requests and their details to the
+// stats packages. PullRequestQuery reads them from GitHub, and other
+// implementations can read them from saved data.
+type PullRequestSource interface {
+	// IteratePullRequests invokes the callback with each pull
+	// request
+	IteratePullRequests(ctx context.Context, callback PRCallback) error
+
+	// Repositories returns the names of the repositories the pull
+	// requests come from
+	Repositories() []string
+
+	// GetPullRequest returns one pull request by its number
+	GetPullRequest(ctx context.Context, repo string, number int) (*github.PullRequest, error)
+
+	GetIssueComments(ctx context.Context, pr *github.PullRequest) ([]*github.IssueComment, error)
+	GetPRComments(ctx context.Context, pr *github.PullRequest) ([]*github.PullRequestComment, error)
+	GetReviews(ctx context.Context, pr *github.PullRequest) ([]*github.PullRequestReview, error)
+	GetCommits(ctx context.Context, pr *github.PullRequest) ([]*github.RepositoryCommit, error)
+	GetTimeline(ctx context.Context, pr *github.PullRequest) ([]*github.Timeline, error)
+	IsMerged(ctx context.Context, pr *github.PullRequest) (bool, error)
+}
+
+var _ PullRequestSource = (*PullRequestQuery)(nil)
+var _ PullRequestSource = (*MemorySource)(nil)
+
+// InRepositories reports whether the repository is one of repos, or
+// whether repos is nil, meaning there is no limit
+func InRepositories(repos []string, repo string) bool {
+	if repos == nil {
+		return true
+	}
+	for _, r := range repos {
+		if r == repo {
+			return true
+		}
+	}
+	return false
+}
+
+// Fetch retrieves all of the details of a pull request from the
+// source
+func Fetch(ctx context.Context, source PullRequestSource, pr *github.PullRequest) (*MemoryPullRequest, error) {
+	var err error
+	result := &MemoryPullRequest{Pull: pr}
+
+	result.Merged, err = source.IsMerged(ctx, pr)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			fmt.Sprintf("could not determine merged status of %s", *pr.HTMLURL))
+	}
+
+	result.IssueComments, err = source.GetIssueComments(ctx, pr)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			fmt.Sprintf("could not fetch issue comments on %s", *pr.HTMLURL))
+	}
+
+	result.PRComments, err = source.GetPRComments(ctx, pr)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			fmt.Sprintf("could not fetch PR comments on %s", *pr.HTMLURL))
+	}
+
+	result.Reviews, err = source.GetReviews(ctx, pr)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			fmt.Sprintf("could not fetch reviews on %s", *pr.HTMLURL))
+	}
+
+	result.Commits, err = source.GetCommits(ctx, pr)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			fmt.Sprintf("could not fetch commits on %s", *pr.HTMLURL))
+	}
+
+	result.Timeline, err = source.GetTimeline(ctx, pr)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			fmt.Sprintf("could not fetch timeline of %s", *pr.HTMLURL))
+	}
+
+	return result, nil
+}
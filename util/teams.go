@@ -0,0 +1,60 @@
+package util
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/pkg/errors"
+)
+
+// ListTeams returns the teams in the organization
+func ListTeams(ctx context.Context, client *github.Client, org string) ([]*github.Team, error) {
+	opts := &github.ListOptions{
+		PerPage: pageSize,
+	}
+	results := []*github.Team{}
+
+	for {
+		teams, response, err := client.Teams.ListTeams(ctx, org, opts)
+		if err != nil {
+			return nil, errors.Wrap(err,
+				fmt.Sprintf("could not list teams in %s", org))
+		}
+		results = append(results, teams...)
+		if response.NextPage == 0 {
+			break
+		}
+		opts.Page = response.NextPage
+	}
+
+	return results, nil
+}
+
+// ListTeamMembers returns the logins of the members of a team in the
+// organization, given the slug of the team
+func ListTeamMembers(ctx context.Context, client *github.Client, org, slug string) ([]string, error) {
+	opts := &github.TeamListTeamMembersOptions{
+		ListOptions: github.ListOptions{
+			PerPage: pageSize,
+		},
+	}
+	results := []string{}
+
+	for {
+		members, response, err := client.Teams.ListTeamMembersBySlug(ctx, org, slug, opts)
+		if err != nil {
+			return nil, errors.Wrap(err,
+				fmt.Sprintf("could not list the members of team %s in %s", slug, org))
+		}
+		for _, member := range members {
+			results = append(results, member.GetLogin())
+		}
+		if response.NextPage == 0 {
+			break
+		}
+		opts.Page = response.NextPage
+	}
+
+	return results, nil
+}
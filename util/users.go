@@ -0,0 +1,16 @@
+package util
+
+import (
+	"strings"
+
+	"github.com/google/go-github/v45/github"
+)
+
+// IsBot reports whether the user is a bot account, based on the type
+// of the account or the "[bot]" suffix GitHub adds to app names
+func IsBot(user *github.User) bool {
+	if user == nil {
+		return false
+	}
+	return user.GetType() == "Bot" || strings.HasSuffix(user.GetLogin(), "[bot]")
+}